@@ -1,5 +1,5 @@
 module github.com/tnyidea/sqlutils
 
-go 1.17
+go 1.18
 
 require github.com/lib/pq v1.10.3
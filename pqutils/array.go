@@ -0,0 +1,110 @@
+package pqutils
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// arrayColumnTypes maps the element type of a slice field to the Postgres array type used for
+// its column.  []byte is not listed because it is stored as BYTEA.
+var arrayColumnTypes = map[reflect.Type]string{
+	reflect.TypeOf(int(0)):     "INTEGER[]",
+	reflect.TypeOf(int32(0)):   "INTEGER[]",
+	reflect.TypeOf(int64(0)):   "BIGINT[]",
+	reflect.TypeOf(float32(0)): "REAL[]",
+	reflect.TypeOf(float64(0)): "DOUBLE PRECISION[]",
+	reflect.TypeOf(false):      "BOOLEAN[]",
+	reflect.TypeOf(""):         "VARCHAR[]",
+	timeType:                   "TIMESTAMPTZ[]",
+}
+
+// arrayValue returns the driver value for a slice field.  pq.Array covers most element types,
+// []int is sent as an int64 array, and []time.Time uses timeArray since pq only knows how to
+// scan time arrays through sql.Scanner elements.
+func arrayValue(v interface{}) interface{} {
+	switch a := v.(type) {
+	case []int:
+		if a == nil {
+			return pq.Int64Array(nil)
+		}
+		ints := make(pq.Int64Array, len(a))
+		for i := range a {
+			ints[i] = int64(a[i])
+		}
+		return ints
+	case []time.Time:
+		return timeArray(a)
+	}
+
+	return pq.Array(v)
+}
+
+// scanArray stores the Postgres array src in the slice field, the reverse of arrayValue.
+func scanArray(field reflect.Value, src interface{}) error {
+	switch a := field.Addr().Interface().(type) {
+	case *[]int:
+		var ints pq.Int64Array
+		if err := ints.Scan(src); err != nil {
+			return err
+		}
+		*a = nil
+		if ints != nil {
+			*a = make([]int, len(ints))
+			for i := range ints {
+				(*a)[i] = int(ints[i])
+			}
+		}
+		return nil
+	case *[]time.Time:
+		return (*timeArray)(a).Scan(src)
+	}
+
+	return pq.Array(field.Addr().Interface()).Scan(src)
+}
+
+// timeArray represents a one-dimensional TIMESTAMPTZ array
+type timeArray []time.Time
+
+// Scan implements the sql.Scanner interface.
+func (a *timeArray) Scan(src interface{}) error {
+	var elements pq.StringArray
+	if err := elements.Scan(src); err != nil {
+		return err
+	}
+	if elements == nil {
+		*a = nil
+		return nil
+	}
+
+	times := make(timeArray, len(elements))
+	for i, element := range elements {
+		t, err := pq.ParseTimestamp(nil, element)
+		if err != nil {
+			return err
+		}
+		times[i] = t
+	}
+	*a = times
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (a timeArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	b := []byte{'{'}
+	for i, t := range a {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '"')
+		b = append(b, pq.FormatTimestamp(t)...)
+		b = append(b, '"')
+	}
+	return string(append(b, '}')), nil
+}
@@ -0,0 +1,120 @@
+package pqutils
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// The operations reported in QueryEvent.Operation.  OperationTx covers BEGIN, COMMIT, ROLLBACK
+// and the savepoint statements of WithTx.
+const (
+	OperationSelect = "select"
+	OperationInsert = "insert"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+	OperationDDL    = "ddl"
+	OperationTx     = "tx"
+)
+
+// QueryEvent describes one statement run through a Client.  BeforeQuery receives the
+// Operation, Table, SQL and Args; Duration, Rows and Err are filled in for AfterQuery.  Rows
+// is the number of rows affected by an Exec, or returned by a query.
+type QueryEvent struct {
+	Operation string
+	Table     string
+	SQL       string
+	Args      []interface{}
+	Duration  time.Duration
+	Rows      int64
+	Err       error
+
+	start time.Time
+}
+
+// Hook observes the statements run through a Client, for tracing, metrics or auditing.
+// BeforeQuery is called before the statement runs and returns the context to run it with,
+// so a tracing hook can start a span.  AfterQuery is called with that context once the
+// statement has finished.  Hooks must not modify the event.
+type Hook interface {
+	BeforeQuery(ctx context.Context, event *QueryEvent) context.Context
+	AfterQuery(ctx context.Context, event *QueryEvent)
+}
+
+// Client is an Executor that runs its hooks around every statement pqutils runs through it.
+// Pass a Client wherever pqutils takes an Executor.  Use Client.WithTx rather than WithTx for
+// transactions, so the statements inside the transaction run the hooks too.
+//
+// The Executor methods of a Client, such as ExecContext, are those of the db it wraps, so
+// calling them directly runs the statement without the hooks.
+type Client struct {
+	Executor
+	hooks []Hook
+}
+
+var _ Executor = (*Client)(nil)
+
+// NewClient returns a Client running statements on db, which may be a *sql.DB, *sql.Tx or
+// *sql.Conn.  The hooks are called in order before each statement, and in reverse order after
+// it.
+func NewClient(db Executor, hooks ...Hook) *Client {
+	return &Client{Executor: db, hooks: hooks}
+}
+
+// WithTx is WithTx for a Client.  fn receives a Client for the transaction with the same hooks.
+func (c *Client) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Client) error) error {
+	return withTx(ctx, c, opts, func(tx Executor) error {
+		return fn(tx.(*Client))
+	})
+}
+
+// withTx is WithTx for the internal helpers.  When db is a Client, fn receives a Client for
+// the transaction with the same hooks, otherwise the *sql.Tx itself.
+func withTx(ctx context.Context, db Executor, opts *sql.TxOptions, fn func(tx Executor) error) error {
+	c, ok := db.(*Client)
+	if !ok {
+		return WithTx(ctx, db, opts, func(tx *sql.Tx) error {
+			return fn(tx)
+		})
+	}
+
+	return WithTx(ctx, c, opts, func(tx *sql.Tx) error {
+		return fn(&Client{Executor: tx, hooks: c.hooks})
+	})
+}
+
+// isTx reports whether db runs its statements in a transaction.
+func isTx(db Executor) bool {
+	if c, ok := db.(*Client); ok {
+		db = c.Executor
+	}
+	_, ok := db.(*sql.Tx)
+	return ok
+}
+
+// startStatement calls the BeforeQuery hooks of db, when it is a Client, and returns the
+// context to run the statement with.
+func startStatement(ctx context.Context, db Executor, event *QueryEvent) context.Context {
+	event.start = time.Now()
+	if c, ok := db.(*Client); ok {
+		for _, hook := range c.hooks {
+			ctx = hook.BeforeQuery(ctx, event)
+		}
+	}
+	return ctx
+}
+
+// finishStatement records the outcome of the statement in event, logs it, and calls the
+// AfterQuery hooks of db when it is a Client.  It returns err converted by databaseError.
+func finishStatement(ctx context.Context, db Executor, event *QueryEvent, rows int64, err error) error {
+	event.Duration = time.Since(event.start)
+	event.Rows = rows
+	event.Err = databaseError(err, event.Operation, event.Table)
+	logStatement(ctx, event)
+	if c, ok := db.(*Client); ok {
+		for i := len(c.hooks) - 1; i >= 0; i-- {
+			c.hooks[i].AfterQuery(ctx, event)
+		}
+	}
+	return event.Err
+}
@@ -4,69 +4,69 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"strings"
 )
 
 // DeleteOne will construct a where condition from the primarykey tags on v.  It will then
 // perform a delete of the record in the specified table that matches the primary key.  If
 // the delete fails, an error will be returned.
-func DeleteOne(db *sql.DB, table string, v interface{}) (sql.Result, error) {
+func DeleteOne(db Executor, table string, v interface{}) (sql.Result, error) {
+	return DeleteOneContext(context.Background(), db, table, v)
+}
+
+// DeleteOneContext is DeleteOne with a caller supplied context.
+func DeleteOneContext(ctx context.Context, db Executor, table string, v interface{}) (sql.Result, error) {
 	// Assumption: v is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(v)
 	if err != nil {
 		return nil, err
 	}
-	stm, err := parseStructMetadata(v)
+
+	where, err := primaryKeyWhere(scm, v)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: What about composite keys?
-	var where map[string]interface{}
-	for columnName, keyType := range scm.columnKeyTypeMap {
-		if strings.Contains(keyType, "primarykey") {
-			if where == nil {
-				where = make(map[string]interface{})
-			}
-			fieldName := scm.columnNameFieldNameMap[columnName]
-			where[fieldName] = fmt.Sprintf("%v", stm.fieldNameValueMap[fieldName])
-		}
-	}
+	result, err := deleteAllWithOptions(ctx, db, table, v, where)
+	return result, contextError(ctx, err)
+}
 
-	return deleteAllWithOptions(db, table, v, where)
+func DeleteAllWithOptions(db Executor, table string, schema interface{}, where Filter) (sql.Result, error) {
+	return DeleteAllWithOptionsContext(context.Background(), db, table, schema, where)
 }
 
-func DeleteAllWithOptions(db *sql.DB, table string, schema interface{}, where map[string]interface{}) (sql.Result, error) {
-	if where == nil {
-		return nil, errors.New("invalid where condition: where must be non-nil.  Use UnsafeDeleteAll to delete all records")
+// DeleteAllWithOptionsContext is DeleteAllWithOptions with a caller supplied context.
+func DeleteAllWithOptionsContext(ctx context.Context, db Executor, table string, schema interface{},
+	where Filter) (sql.Result, error) {
+	if emptyFilter(where) {
+		return nil, errors.New("invalid where condition: where must be non-nil and non-empty.  Use UnsafeDeleteAll to delete all records")
 	}
 
-	return deleteAllWithOptions(db, table, schema, where)
+	result, err := deleteAllWithOptions(ctx, db, table, schema, where)
+	return result, contextError(ctx, err)
 }
 
 // UnsafeDeleteAll deletes ALL RECORDS from the specified table. This is marked with the
 // prefix Unsafe to remind the user that it is a destructive function and should be used carefully.
-func UnsafeDeleteAll(db *sql.DB, table string) (sql.Result, error) {
-	return deleteAllWithOptions(db, table, struct{}{}, nil)
+func UnsafeDeleteAll(db Executor, table string) (sql.Result, error) {
+	return UnsafeDeleteAllContext(context.Background(), db, table)
 }
 
-func deleteAllWithOptions(db *sql.DB, table string, schema interface{}, where map[string]interface{}) (sql.Result, error) {
-	// Assumption: schema is a pointer to a struct
+// UnsafeDeleteAllContext is UnsafeDeleteAll with a caller supplied context.
+func UnsafeDeleteAllContext(ctx context.Context, db Executor, table string) (sql.Result, error) {
+	result, err := deleteAllWithOptions(ctx, db, table, &struct{}{}, nil)
+	return result, contextError(ctx, err)
+}
 
-	whereCondition, err := queryConditionString(schema, where, QueryOptions{})
-	stmt := `DELETE FROM ` + table + ` ` + whereCondition
+func deleteAllWithOptions(ctx context.Context, db Executor, table string, schema interface{}, where Filter) (sql.Result, error) {
+	// Assumption: schema is a pointer to a struct
 
-	// Execute the Statement
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
+	whereCondition, args, err := queryConditionString(schema, where, QueryOptions{}, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
+	stmt := `DELETE FROM ` + table + ` ` + whereCondition
 
-	return conn.ExecContext(ctx, stmt)
+	// Execute the Statement
+	return execStatement(ctx, db, OperationDelete, table, stmt, args...)
 }
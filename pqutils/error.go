@@ -1,22 +1,294 @@
 package pqutils
 
-import "reflect"
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"reflect"
+	"strconv"
+	"strings"
+)
 
+// InvalidTypeError is returned when a value passed to pqutils has a type it can't work with.
+// RequiredType describes the type that was expected: "StructPtr" for a non-nil pointer to a
+// struct, "SlicePtr" for a pointer to a slice of structs, or a type name.
 type InvalidTypeError struct {
 	RequiredType string
 	InvalidType  reflect.Type
 }
 
 func (e *InvalidTypeError) Error() string {
-	if e.RequiredType == "StructPtr" &&
-		(e.InvalidType == nil || e.InvalidType.Kind() != reflect.Ptr) {
-		return "invalid type: must be a non-nil pointer to a struct: " + e.InvalidType.String()
+	invalidType := "nil"
+	if e.InvalidType != nil {
+		invalidType = e.InvalidType.String()
 	}
 
-	if e.RequiredType == "SlicePtr" &&
-		e.InvalidType.Kind() != reflect.Slice {
-		return "invalid type: must be a pointer to a slice of struct: " + e.InvalidType.String()
+	switch e.RequiredType {
+	case "StructPtr":
+		return "invalid type: must be a non-nil pointer to a struct: " + invalidType
+	case "SlicePtr":
+		return "invalid type: must be a pointer to a slice of struct: " + invalidType
+	case "":
+		return "invalid type: " + invalidType
 	}
+	return "invalid type: must be " + e.RequiredType + ": " + invalidType
+}
+
+// CanceledError is returned by the ...Context functions when the operation stopped because
+// its context was canceled or its deadline passed.  Err holds the context error, so callers
+// can also test for context.Canceled or context.DeadlineExceeded with errors.Is.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return "operation canceled: " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// contextError replaces err with a CanceledError when ctx is done.  Whatever the driver
+// reported in that case is a side effect of the cancellation, not the cause.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		var canceledError *CanceledError
+		if errors.As(err, &canceledError) {
+			return err
+		}
+		return &CanceledError{Err: ctxErr}
+	}
+
+	return err
+}
+
+// ScanError is returned when a column of a result row cannot be stored in the struct field
+// it maps to.  Err describes the failed conversion, or is nil when the database type and the
+// field type are simply incompatible.
+type ScanError struct {
+	Column       string
+	DatabaseType string
+	FieldType    reflect.Type
+	Err          error
+}
+
+func (e *ScanError) Error() string {
+	message := "scan error: cannot assign column " + e.Column + " of type " + e.DatabaseType +
+		" to field of type " + e.FieldType.String()
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// KeyError is returned by the functions that find a record by its primary key (SelectOne,
+// UpdateOne, DeleteOne, ...) when v can't identify one: either its type has no primarykey
+// fields, or ZeroFields lists the primary key fields that hold zero values.
+type KeyError struct {
+	Type       reflect.Type
+	ZeroFields []string
+}
 
-	return "invalid type: " + e.InvalidType.String()
+func (e *KeyError) Error() string {
+	if len(e.ZeroFields) == 0 {
+		return "invalid key: " + e.Type.String() + " has no primarykey fields"
+	}
+	return "invalid key: zero value received for primary key field(s) " + strings.Join(e.ZeroFields, ", ") +
+		" of " + e.Type.String() + ". All primary key fields must be non-zero"
+}
+
+// RowError is returned by InsertAll for each row that was not inserted.  Index is the position
+// of the row in the slice passed to InsertAll and Err is the reason the row failed, which is
+// shared by every row of a failed batch.
+type RowError struct {
+	Index int
+	Err   error
+}
+
+func (e *RowError) Error() string {
+	return "row " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNotFound is returned when a statement that must find a record finds none, such as
+// SelectOne and Get when no record has the key.
+var ErrNotFound = errors.New("pqutils: record not found")
+
+// MultipleRowsError is returned by SelectOne and Get when more than one record of Table
+// matches the primary key of a value of Type, because the table has no matching constraint.
+type MultipleRowsError struct {
+	Table string
+	Type  reflect.Type
+}
+
+func (e *MultipleRowsError) Error() string {
+	return "multiple rows: more than one record of " + e.Table + " matches the primary key of " + e.Type.String()
+}
+
+// The Postgres error codes mapped to typed errors by databaseError
+const (
+	uniqueViolation      = "23505"
+	foreignKeyViolation  = "23503"
+	notNullViolation     = "23502"
+	checkViolation       = "23514"
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// UniqueViolationError is returned when a statement would store a duplicate value for a
+// primary key or unique constraint.  Columns lists the columns of the constraint when
+// Postgres reports them.  Err is the *pq.Error returned by the driver.
+type UniqueViolationError struct {
+	Operation  string
+	Table      string
+	Constraint string
+	Columns    []string
+	Err        error
+}
+
+func (e *UniqueViolationError) Error() string {
+	return "unique violation on " + statementDescription(e.Operation, e.Table) + ": constraint " + e.Constraint +
+		constraintColumns(e.Columns) + ": " + e.Err.Error()
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return e.Err
+}
+
+// ForeignKeyViolationError is returned when a statement would store a reference to a missing
+// record, or delete a record that is still referenced.
+type ForeignKeyViolationError struct {
+	Operation  string
+	Table      string
+	Constraint string
+	Columns    []string
+	Err        error
+}
+
+func (e *ForeignKeyViolationError) Error() string {
+	return "foreign key violation on " + statementDescription(e.Operation, e.Table) + ": constraint " + e.Constraint +
+		constraintColumns(e.Columns) + ": " + e.Err.Error()
+}
+
+func (e *ForeignKeyViolationError) Unwrap() error {
+	return e.Err
+}
+
+// NotNullViolationError is returned when a statement would store NULL in a NOT NULL column.
+type NotNullViolationError struct {
+	Operation string
+	Table     string
+	Column    string
+	Err       error
+}
+
+func (e *NotNullViolationError) Error() string {
+	return "not null violation on " + statementDescription(e.Operation, e.Table) + ": column " + e.Column +
+		": " + e.Err.Error()
+}
+
+func (e *NotNullViolationError) Unwrap() error {
+	return e.Err
+}
+
+// CheckViolationError is returned when a statement would store a row that fails a CHECK
+// constraint.
+type CheckViolationError struct {
+	Operation  string
+	Table      string
+	Constraint string
+	Err        error
+}
+
+func (e *CheckViolationError) Error() string {
+	return "check violation on " + statementDescription(e.Operation, e.Table) + ": constraint " + e.Constraint +
+		": " + e.Err.Error()
+}
+
+func (e *CheckViolationError) Unwrap() error {
+	return e.Err
+}
+
+// SerializationFailureError is returned when Postgres aborts a transaction because of a
+// serialization failure or a deadlock with a concurrent transaction.  The whole transaction
+// can be retried.
+type SerializationFailureError struct {
+	Operation string
+	Table     string
+	Err       error
+}
+
+func (e *SerializationFailureError) Error() string {
+	return "serialization failure on " + statementDescription(e.Operation, e.Table) + ": " + e.Err.Error()
+}
+
+func (e *SerializationFailureError) Unwrap() error {
+	return e.Err
+}
+
+// databaseError converts the error of a statement into one of the typed errors above when
+// the driver reports a matching *pq.Error, and returns any other error unchanged.
+func databaseError(err error, operation string, table string) error {
+	var pqError *pq.Error
+	if !errors.As(err, &pqError) {
+		return err
+	}
+	if pqError.Table != "" {
+		table = pqError.Table
+	}
+
+	switch pqError.Code {
+	case uniqueViolation:
+		return &UniqueViolationError{Operation: operation, Table: table, Constraint: pqError.Constraint,
+			Columns: keyDetailColumns(pqError.Detail), Err: err}
+	case foreignKeyViolation:
+		return &ForeignKeyViolationError{Operation: operation, Table: table, Constraint: pqError.Constraint,
+			Columns: keyDetailColumns(pqError.Detail), Err: err}
+	case notNullViolation:
+		return &NotNullViolationError{Operation: operation, Table: table, Column: pqError.Column, Err: err}
+	case checkViolation:
+		return &CheckViolationError{Operation: operation, Table: table, Constraint: pqError.Constraint, Err: err}
+	case serializationFailure, deadlockDetected:
+		return &SerializationFailureError{Operation: operation, Table: table, Err: err}
+	}
+
+	return err
+}
+
+// keyDetailColumns returns the columns named in the detail of a key violation, which has the
+// form:  Key (tenant_id, email)=(1, a@example.com) already exists.
+func keyDetailColumns(detail string) []string {
+	if !strings.HasPrefix(detail, "Key (") {
+		return nil
+	}
+	end := strings.Index(detail, ")=(")
+	if end < 0 {
+		return nil
+	}
+	return strings.Split(detail[len("Key ("):end], ", ")
+}
+
+func statementDescription(operation string, table string) string {
+	if table == "" {
+		return operation
+	}
+	return operation + " of " + table
+}
+
+func constraintColumns(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(columns, ", ") + ")"
 }
@@ -0,0 +1,25 @@
+package pqutils
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Executor is the set of database/sql methods pqutils uses to run its statements.  *sql.DB,
+// *sql.Tx and *sql.Conn all satisfy it, so the same helpers can run against the connection
+// pool, inside a caller managed transaction, or on a pinned connection.
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// txBeginner is implemented by the executors that can start a transaction: *sql.DB and *sql.Conn
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+var _ Executor = (*sql.DB)(nil)
+var _ Executor = (*sql.Tx)(nil)
+var _ Executor = (*sql.Conn)(nil)
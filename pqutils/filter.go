@@ -0,0 +1,330 @@
+package pqutils
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Filter is a condition for the WHERE clause of a statement.  Filters are built with Where and
+// the constructor functions below (Eq, Lt, In, Or, ...) and can be nested freely.  Every field
+// is named by its struct field name, or by its json name with a "json:" prefix, exactly like
+// the keys of Where.  Values are always passed as statement arguments, never as SQL text.
+type Filter interface {
+	condition(b *conditionBuilder) (string, error)
+}
+
+// Where is the simplest Filter: every entry must equal its value, and the entries are ANDed
+// together.  A value written as NULL, such as nil or a nil pointer, matches NULL.  An empty
+// Where matches every record.
+//
+// Example:  Where{"LastName": "Smith", "json:active": true}
+type Where map[string]interface{}
+
+func (w Where) condition(b *conditionBuilder) (string, error) {
+	// Resolve the names first, then build the conditions in schema order so the same where
+	// always produces the same statement
+	fieldValues := make(map[string]interface{}, len(w))
+	for name, value := range w {
+		fieldName, err := b.fieldName(name)
+		if err != nil {
+			return "", err
+		}
+		fieldValues[fieldName] = value
+	}
+
+	var conditions []string
+	for _, fieldName := range b.scm.fieldNames {
+		value, ok := fieldValues[fieldName]
+		if !ok {
+			continue
+		}
+		condition, err := Eq(fieldName, value).condition(b)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+type comparisonFilter struct {
+	field    string
+	operator string
+	value    interface{}
+}
+
+// Eq matches records where field equals value.  A value written as NULL, such as nil, a nil
+// pointer or an invalid sql.Null* value, matches NULL.
+func Eq(field string, value interface{}) Filter {
+	return comparisonFilter{field: field, operator: "=", value: value}
+}
+
+// Ne matches records where field does not equal value.  A value written as NULL matches NOT
+// NULL.
+func Ne(field string, value interface{}) Filter {
+	return comparisonFilter{field: field, operator: "<>", value: value}
+}
+
+// Lt matches records where field is less than value.
+func Lt(field string, value interface{}) Filter {
+	return comparisonFilter{field: field, operator: "<", value: value}
+}
+
+// Le matches records where field is less than or equal to value.
+func Le(field string, value interface{}) Filter {
+	return comparisonFilter{field: field, operator: "<=", value: value}
+}
+
+// Gt matches records where field is greater than value.
+func Gt(field string, value interface{}) Filter {
+	return comparisonFilter{field: field, operator: ">", value: value}
+}
+
+// Ge matches records where field is greater than or equal to value.
+func Ge(field string, value interface{}) Filter {
+	return comparisonFilter{field: field, operator: ">=", value: value}
+}
+
+// Like matches records where field matches the LIKE pattern.
+func Like(field string, pattern string) Filter {
+	return comparisonFilter{field: field, operator: "LIKE", value: pattern}
+}
+
+// ILike matches records where field matches the pattern, ignoring case.
+func ILike(field string, pattern string) Filter {
+	return comparisonFilter{field: field, operator: "ILIKE", value: pattern}
+}
+
+func (f comparisonFilter) condition(b *conditionBuilder) (string, error) {
+	columnName, err := b.columnName(f.field)
+	if err != nil {
+		return "", err
+	}
+
+	// Comparing with NULL is never true, so equality with NULL means IS NULL
+	if isNullArg(b.scm.columnArg(columnName, f.value)) {
+		switch f.operator {
+		case "=":
+			return columnName + " IS NULL", nil
+		case "<>":
+			return columnName + " IS NOT NULL", nil
+		}
+		return "", errors.New("invalid value for where condition: nil can't be compared with " + f.operator + ": " + f.field)
+	}
+
+	return columnName + " " + f.operator + " " + b.placeholder(columnName, f.value), nil
+}
+
+type nullFilter struct {
+	field string
+	not   bool
+}
+
+// IsNull matches records where field is NULL.
+func IsNull(field string) Filter {
+	return nullFilter{field: field}
+}
+
+// IsNotNull matches records where field is not NULL.
+func IsNotNull(field string) Filter {
+	return nullFilter{field: field, not: true}
+}
+
+func (f nullFilter) condition(b *conditionBuilder) (string, error) {
+	columnName, err := b.columnName(f.field)
+	if err != nil {
+		return "", err
+	}
+	if f.not {
+		return columnName + " IS NOT NULL", nil
+	}
+	return columnName + " IS NULL", nil
+}
+
+type inFilter struct {
+	field  string
+	values []interface{}
+	not    bool
+}
+
+// In matches records where field equals one of values.  A single slice argument is expanded,
+// so In("Id", ids) and In("Id", 1, 2, 3) are equivalent.  With no values nothing matches.
+func In(field string, values ...interface{}) Filter {
+	return inFilter{field: field, values: expandValues(values)}
+}
+
+// NotIn matches records where field equals none of values.  Values are expanded as they are
+// for In.  With no values every record matches.
+func NotIn(field string, values ...interface{}) Filter {
+	return inFilter{field: field, values: expandValues(values), not: true}
+}
+
+func (f inFilter) condition(b *conditionBuilder) (string, error) {
+	columnName, err := b.columnName(f.field)
+	if err != nil {
+		return "", err
+	}
+	if len(f.values) == 0 {
+		// Like an empty Where, an empty NotIn is an empty condition so emptyFilter can see it
+		// matches every record
+		if f.not {
+			return "", nil
+		}
+		return "FALSE", nil
+	}
+
+	var placeholders []string
+	for _, value := range f.values {
+		placeholders = append(placeholders, b.placeholder(columnName, value))
+	}
+	operator := " IN ("
+	if f.not {
+		operator = " NOT IN ("
+	}
+	return columnName + operator + strings.Join(placeholders, ", ") + ")", nil
+}
+
+// expandValues returns the elements of values[0] when it is the only value and a slice other
+// than []byte, and values unchanged otherwise.
+func expandValues(values []interface{}) []interface{} {
+	if len(values) != 1 {
+		return values
+	}
+	rv := reflect.ValueOf(values[0])
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+
+	expanded := make([]interface{}, rv.Len())
+	for i := range expanded {
+		expanded[i] = rv.Index(i).Interface()
+	}
+	return expanded
+}
+
+type betweenFilter struct {
+	field string
+	low   interface{}
+	high  interface{}
+}
+
+// Between matches records where field lies between low and high, inclusive.
+func Between(field string, low interface{}, high interface{}) Filter {
+	return betweenFilter{field: field, low: low, high: high}
+}
+
+func (f betweenFilter) condition(b *conditionBuilder) (string, error) {
+	columnName, err := b.columnName(f.field)
+	if err != nil {
+		return "", err
+	}
+	if isNullArg(b.scm.columnArg(columnName, f.low)) || isNullArg(b.scm.columnArg(columnName, f.high)) {
+		return "", errors.New("invalid value for where condition: nil bound for BETWEEN: " + f.field)
+	}
+
+	return columnName + " BETWEEN " + b.placeholder(columnName, f.low) + " AND " + b.placeholder(columnName, f.high), nil
+}
+
+type groupFilter struct {
+	operator string
+	filters  []Filter
+}
+
+// And matches records that match every one of filters.  With no filters every record matches.
+func And(filters ...Filter) Filter {
+	return groupFilter{operator: " AND ", filters: filters}
+}
+
+// Or matches records that match at least one of filters.  With no filters nothing matches.
+func Or(filters ...Filter) Filter {
+	return groupFilter{operator: " OR ", filters: filters}
+}
+
+func (f groupFilter) condition(b *conditionBuilder) (string, error) {
+	var conditions []string
+	for _, filter := range f.filters {
+		if filter == nil {
+			return "", errors.New("invalid where condition: nil Filter in And or Or")
+		}
+		condition, err := filter.condition(b)
+		if err != nil {
+			return "", err
+		}
+		if condition == "" {
+			// An empty condition matches every record, which decides an OR and adds
+			// nothing to an AND
+			if f.operator == " OR " {
+				return "", nil
+			}
+			continue
+		}
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	if len(conditions) == 0 && f.operator == " OR " {
+		return "FALSE", nil
+	}
+	return strings.Join(conditions, f.operator), nil
+}
+
+// emptyFilter reports whether where is nil or holds no conditions, so it would match every
+// record in the table.  It must agree with the filters that return an empty condition.
+func emptyFilter(where Filter) bool {
+	switch filter := where.(type) {
+	case nil:
+		return true
+	case Where:
+		return len(filter) == 0
+	case inFilter:
+		return filter.not && len(filter.values) == 0
+	case groupFilter:
+		// An OR is empty as soon as one of its filters is, an AND only when all of them are
+		or := filter.operator == " OR "
+		for _, f := range filter.filters {
+			if emptyFilter(f) == or {
+				return or
+			}
+		}
+		return !or
+	}
+
+	return false
+}
+
+// conditionBuilder resolves field names against a schema and collects the statement arguments
+// while a Filter is turned into SQL.
+type conditionBuilder struct {
+	scm  schemaMetadata
+	stm  structMetadata
+	args []interface{}
+}
+
+// fieldName resolves a struct field name or a "json:" prefixed json name to the struct field
+// name.
+func (b *conditionBuilder) fieldName(name string) (string, error) {
+	fieldName := name
+	if strings.HasPrefix(fieldName, "json:") {
+		fieldName = b.stm.jsonNameFieldNameMap[strings.TrimPrefix(fieldName, "json:")]
+	}
+	if _, ok := b.scm.fieldNameColumnNameMap[fieldName]; !ok {
+		return "", errors.New("invalid fieldName for where condition: " + name)
+	}
+	return fieldName, nil
+}
+
+func (b *conditionBuilder) columnName(name string) (string, error) {
+	fieldName, err := b.fieldName(name)
+	if err != nil {
+		return "", err
+	}
+	return b.scm.fieldNameColumnNameMap[fieldName], nil
+}
+
+// placeholder appends value to the statement arguments and returns its $n placeholder.
+func (b *conditionBuilder) placeholder(columnName string, value interface{}) string {
+	b.args = append(b.args, b.scm.columnArg(columnName, value))
+	return "$" + strconv.Itoa(len(b.args))
+}
@@ -0,0 +1,109 @@
+package pqutils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// Select is the typed form of SelectAllWithOptions.  T must be a struct type with sql tags,
+// and the matching rows are returned as a []T.
+func Select[T any](db Executor, table string, where Filter, options QueryOptions) ([]T, error) {
+	return SelectContext[T](context.Background(), db, table, where, options)
+}
+
+// SelectContext is Select with a caller supplied context.
+func SelectContext[T any](ctx context.Context, db Executor, table string, where Filter,
+	options QueryOptions) ([]T, error) {
+	results, err := selectAllWithOptions(ctx, db, table, new(T), where, options)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return typedResults[T](results), nil
+}
+
+// Get is the typed form of SelectOne.  The primarykey fields of key identify the record to
+// return, and ErrNotFound is returned when there is none.
+func Get[T any](db Executor, table string, key T) (T, error) {
+	return GetContext(context.Background(), db, table, key)
+}
+
+// GetContext is Get with a caller supplied context.
+func GetContext[T any](ctx context.Context, db Executor, table string, key T) (T, error) {
+	result, err := SelectOneContext(ctx, db, table, &key)
+	return typedResult[T](result), err
+}
+
+// Find is Get for records that may not exist.  It reports whether the record was found
+// instead of returning ErrNotFound.
+func Find[T any](db Executor, table string, key T) (T, bool, error) {
+	return FindContext(context.Background(), db, table, key)
+}
+
+// FindContext is Find with a caller supplied context.
+func FindContext[T any](ctx context.Context, db Executor, table string, key T) (T, bool, error) {
+	result, err := GetContext(ctx, db, table, key)
+	if errors.Is(err, ErrNotFound) {
+		return result, false, nil
+	}
+	return result, err == nil, err
+}
+
+// Insert is the typed form of InsertOne.  It returns the inserted record as stored by the
+// database, including any serial primary key.
+func Insert[T any](db Executor, table string, v T) (T, error) {
+	return InsertContext(context.Background(), db, table, v)
+}
+
+// InsertContext is Insert with a caller supplied context.
+func InsertContext[T any](ctx context.Context, db Executor, table string, v T) (T, error) {
+	result, err := insertOne(ctx, db, table, &v)
+	return typedResult[T](result), contextError(ctx, err)
+}
+
+// Upsert is the typed form of UpsertOne.  With options.DoNothing a conflicting row is left
+// alone and the zero T is returned.
+func Upsert[T any](db Executor, table string, v T, options UpsertOptions) (T, error) {
+	return UpsertContext(context.Background(), db, table, v, options)
+}
+
+// UpsertContext is Upsert with a caller supplied context.
+func UpsertContext[T any](ctx context.Context, db Executor, table string, v T, options UpsertOptions) (T, error) {
+	result, err := upsertOne(ctx, db, table, &v, options)
+	return typedResult[T](result), contextError(ctx, err)
+}
+
+func typedResult[T any](result interface{}) T {
+	typed, _ := result.(T)
+	return typed
+}
+
+func typedResults[T any](results []interface{}) []T {
+	if results == nil {
+		return nil
+	}
+
+	typed := make([]T, len(results))
+	for i, result := range results {
+		typed[i] = typedResult[T](result)
+	}
+	return typed
+}
+
+// structPointers returns the elements of v as the pointers to structs the reflection based
+// helpers expect.  Struct elements are copied into new values, pointer elements and interface
+// elements holding pointers are passed through unchanged.
+func structPointers[T any](v []T) []interface{} {
+	values := make([]interface{}, len(v))
+	for i := range v {
+		var value interface{} = v[i]
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Struct {
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			value = ptr.Interface()
+		}
+		values[i] = value
+	}
+	return values
+}
@@ -2,172 +2,304 @@ package pqutils
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/lib/pq"
-	"log"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-func InsertOne(db *sql.DB, table string, v interface{}) (interface{}, error) {
-	// Create the connection
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
+func InsertOne(db Executor, table string, v interface{}) (interface{}, error) {
+	return InsertOneContext(context.Background(), db, table, v)
+}
 
-	return insertOne(conn, ctx, table, v)
+// InsertOneContext is InsertOne with a caller supplied context.
+func InsertOneContext(ctx context.Context, db Executor, table string, v interface{}) (interface{}, error) {
+	result, err := insertOne(ctx, db, table, v)
+	return result, contextError(ctx, err)
 }
 
-func InsertAll(db *sql.DB, table string, v []interface{}) ([]interface{}, []error) {
-	// Create the connection
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
-	if err != nil {
-		return nil, []error{err}
+// InsertAll inserts every element of v and returns the stored rows in the order of v.  The
+// rows are sent in batches of DefaultInsertBatchSize rows; see InsertAllWithOptions.
+func InsertAll(db Executor, table string, v []interface{}) ([]interface{}, []error) {
+	return InsertAllContext(context.Background(), db, table, v)
+}
+
+// InsertAllContext is InsertAll with a caller supplied context.
+func InsertAllContext(ctx context.Context, db Executor, table string, v []interface{}) ([]interface{}, []error) {
+	return insertAll(ctx, db, table, v, InsertOptions{})
+}
+
+// DefaultInsertBatchSize is the number of rows InsertAll sends in one statement
+const DefaultInsertBatchSize = 500
+
+// maxParameters is the most statement parameters Postgres accepts
+const maxParameters = 65535
+
+// InsertOptions controls how InsertAllWithOptions batches its rows.
+type InsertOptions struct {
+	// BatchSize is the number of rows sent in one statement.  It is reduced as needed
+	// to stay within the Postgres limit of 65535 parameters per statement, and zero means
+	// DefaultInsertBatchSize.
+	BatchSize int
+}
+
+// InsertAllWithOptions inserts every element of v in batches of options.BatchSize rows, using
+// one statement per batch, and returns the stored rows in the order of v.  The struct type is
+// taken from the first element that is a non-nil pointer to a struct.
+//
+// Each batch is inserted completely or not at all.  When a batch fails, or an element is not
+// a non-nil pointer to that struct type, a RowError is returned for each row that was not
+// inserted and its result is nil; the other rows are still inserted.
+func InsertAllWithOptions(db Executor, table string, v []interface{}, options InsertOptions) ([]interface{}, []error) {
+	return InsertAllWithOptionsContext(context.Background(), db, table, v, options)
+}
+
+// InsertAllWithOptionsContext is InsertAllWithOptions with a caller supplied context.
+func InsertAllWithOptionsContext(ctx context.Context, db Executor, table string, v []interface{},
+	options InsertOptions) ([]interface{}, []error) {
+	return insertAll(ctx, db, table, v, options)
+}
+
+func insertAll(ctx context.Context, db Executor, table string, v []interface{}, options InsertOptions) ([]interface{}, []error) {
+	// Assumption: interface{} elements of v are pointers to structs
+	if len(v) == 0 {
+		return nil, nil
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
 
-	// TODO there is no provision for insertAll in sql.  Should we interfere with
-	//   driver implementation and construct our own result?
-	var results []interface{}
+	results := make([]interface{}, len(v))
 	var errs []error
-	for _, value := range v {
-		result, err := insertOne(conn, ctx, table, value)
-		if err != nil {
-			errs = append(errs, err)
+	schema := -1
+	for i, value := range v {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct {
+			schema = i
+			break
+		}
+	}
+	if schema < 0 {
+		for i, value := range v {
+			_, err := parseSchemaMetadata(value)
+			errs = append(errs, &RowError{Index: i, Err: err})
+		}
+		return results, errs
+	}
+	scm, err := parseSchemaMetadata(v[schema])
+	if err != nil {
+		for i := range v {
+			errs = append(errs, &RowError{Index: i, Err: err})
 		}
-		results = append(results, result)
+		return results, errs
 	}
 
+	stmtColumns := insertColumns(scm)
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultInsertBatchSize
+	}
+	if len(stmtColumns) > 0 && batchSize > maxParameters/len(stmtColumns) {
+		batchSize = maxParameters / len(stmtColumns)
+	}
+
+	var batch []int
+	insertBatch := func() {
+		values := make([]interface{}, len(batch))
+		for i, index := range batch {
+			values[i] = v[index]
+		}
+		batchResults, err := insertRows(ctx, db, table, scm, stmtColumns, values)
+		for i, index := range batch {
+			if err != nil {
+				errs = append(errs, &RowError{Index: index, Err: contextError(ctx, err)})
+				continue
+			}
+			results[index] = batchResults[i]
+		}
+		batch = nil
+	}
+	for i, value := range v {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Type() != scm.schemaType {
+			errs = append(errs, &RowError{Index: i, Err: &InvalidTypeError{
+				RequiredType: "non-nil *" + scm.schemaType.String(), InvalidType: reflect.TypeOf(value)}})
+			continue
+		}
+		batch = append(batch, i)
+		if len(batch) == batchSize {
+			insertBatch()
+		}
+	}
+	if batch != nil {
+		insertBatch()
+	}
+
+	// Rows of a failed batch are reported with the rows of the batches after it, so sort them
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*RowError).Index < errs[j].(*RowError).Index
+	})
 	return results, errs
 }
 
-func BulkInsert(db *sql.DB, table string, v []interface{}) error {
-	// Assumption: interface{} elements of v are pointers to structs
-	if v == nil {
-		return errors.New("invalid slice: nil value recived for v. Nothing to insert")
+// insertRows inserts values, pointers to structs of the scm type, in a single statement and
+// returns the stored rows in the order of values.  Inside a transaction the statement runs under a savepoint, so a
+// failed batch leaves the transaction usable for the next one.
+func insertRows(ctx context.Context, db Executor, table string, scm schemaMetadata, stmtColumns []string,
+	values []interface{}) ([]interface{}, error) {
+	if isTx(db) {
+		var results []interface{}
+		err := withTx(ctx, db, nil, func(tx Executor) error {
+			var err error
+			results, err = queryInsertRows(ctx, tx, table, scm, stmtColumns, values)
+			return err
+		})
+		return results, err
 	}
 
-	schema := v[0]
-	scm, err := parseSchemaMetadata(schema)
+	return queryInsertRows(ctx, db, table, scm, stmtColumns, values)
+}
+
+// queryInsertRows inserts values with one statement.  Postgres doesn't guarantee the order
+// RETURNING lists the rows of a multi-row insert in, so every row is inserted by its own INSERT
+// in a WITH clause instead, and the rows are selected back ordered by their position in values.
+// The pqutils_ordinal column is not in the schema, so the results skip it.
+func queryInsertRows(ctx context.Context, db Executor, table string, scm schemaMetadata, stmtColumns []string,
+	values []interface{}) ([]interface{}, error) {
+	columnList := strings.Join(insertColumnList(scm, stmtColumns), ", ")
+	var stmtInserts []string
+	var stmtSelects []string
+	var stmtValues []interface{}
+	for i, value := range values {
+		var stmtRow string
+		stmtRow, stmtValues = insertValuesRow(scm, stmtColumns, reflect.ValueOf(value).Elem(), stmtValues)
+		ordinal := strconv.Itoa(i)
+		stmtInserts = append(stmtInserts, `pqutils_row_`+ordinal+` AS (INSERT INTO `+table+` (`+columnList+`) `+
+			`VALUES `+stmtRow+` RETURNING *)`)
+		stmtSelects = append(stmtSelects, `SELECT `+ordinal+` AS pqutils_ordinal, * FROM pqutils_row_`+ordinal)
+	}
+
+	stmt := `WITH ` + strings.Join(stmtInserts, ", ") + `
+		     SELECT * FROM (` + strings.Join(stmtSelects, " UNION ALL ") + `) AS pqutils_rows
+		     ORDER BY pqutils_ordinal`
+
+	// Execute the Statement
+	results, err := queryStatement(ctx, db, OperationInsert, table, values[0], stmt, stmtValues...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(results) != len(values) {
+		return nil, errors.New("invalid result: " + strconv.Itoa(len(values)) + " rows inserted but " +
+			strconv.Itoa(len(results)) + " returned")
+	}
+
+	return results, nil
+}
+
+// BulkInsert copies every element of v into the specified table in a single COPY.  The
+// elements may be structs, pointers to structs, or interface values holding pointers to
+// structs, so both []T and the older []interface{} form are accepted.
+func BulkInsert[T any](db Executor, table string, v []T) error {
+	return BulkInsertContext(context.Background(), db, table, v)
+}
+
+// BulkInsertContext is BulkInsert with a caller supplied context.
+func BulkInsertContext[T any](ctx context.Context, db Executor, table string, v []T) error {
+	return contextError(ctx, bulkInsert(ctx, db, table, structPointers(v)))
+}
+
+func bulkInsert(ctx context.Context, db Executor, table string, v []interface{}) error {
+	// Assumption: interface{} elements of v are pointers to structs
+	if len(v) == 0 {
+		return errors.New("invalid slice: empty or nil value recived for v. Nothing to insert")
 	}
 
-	// Create the connection
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
+	schema := v[0]
+	scm, err := parseSchemaMetadata(schema)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
 
-	count := len(v)
-	log.Println("--- Begin Bulk Insert for", count, "Items ---")
+	stmtColumns := insertColumns(scm)
 
-	tx, err := conn.BeginTx(ctx, nil)
+	// COPY must run inside a transaction.  If db is already a transaction, WithTx copies
+	// under a savepoint and leaves the commit to the caller.
+	err = withTx(ctx, db, nil, func(tx Executor) error {
+		return copyIn(ctx, tx, table, scm, stmtColumns, v)
+	})
 	if err != nil {
 		return err
 	}
 
-	var stmtColumns []string
-	// TODO make a util that reduces list of columnNames to strip those that use default
-	for _, columnName := range scm.columnNames {
-		// We need to eliminate any key columns that are primarykey:serial
-		// so the database can default these values
-		// TODO perhaps a more robust approach is to assert in the type to use default?
-		if scm.columnKeyTypeMap[columnName] == "primarykey:serial" {
-			continue
+	return nil
+}
+
+// copyIn copies v into table with a single COPY on tx.  The COPY is logged and reported to
+// the hooks as one statement once every row has been sent.
+func copyIn(ctx context.Context, tx Executor, table string, scm schemaMetadata, stmtColumns []string, v []interface{}) (err error) {
+	copyStatement := pq.CopyIn(table, stmtColumns...)
+	event := &QueryEvent{Operation: OperationInsert, Table: table, SQL: copyStatement}
+	ctx = startStatement(ctx, tx, event)
+	defer func() {
+		var rows int64
+		if err == nil {
+			rows = int64(len(v))
 		}
-		stmtColumns = append(stmtColumns, columnName)
-	}
-	log.Println(stmtColumns)
+		err = finishStatement(ctx, tx, event, rows, err)
+	}()
 
 	// Prepare the Bulk Insert
-	stmt, err := tx.Prepare(pq.CopyIn(table, stmtColumns...))
+	stmt, err := tx.PrepareContext(ctx, copyStatement)
 	if err != nil {
-		_ = tx.Rollback()
 		return err
 	}
-	for i, value := range v {
-		stm, err := parseStructMetadata(value)
-		if err != nil {
-			return err
+	defer func() {
+		_ = stmt.Close()
+	}()
+	for _, value := range v {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Type() != scm.schemaType {
+			return &InvalidTypeError{RequiredType: "non-nil *" + scm.schemaType.String(),
+				InvalidType: reflect.TypeOf(value)}
 		}
 		var stmtValues []interface{}
 		for _, columnName := range stmtColumns {
-			fieldName := scm.columnNameFieldNameMap[columnName]
-			stmtValues = append(stmtValues, stm.fieldNameValueMap[fieldName])
+			stmtValues = append(stmtValues, scm.columnArg(columnName, scm.columnValue(rv.Elem(), columnName)))
 		}
-		log.Println("| Adding Value", i+1, "of", count)
 		_, err = stmt.ExecContext(ctx, stmtValues...)
 		if err != nil {
-			log.Println(err)
-			_ = tx.Rollback()
 			return err
 		}
 	}
 
 	// Execute the Bulk Insert
 	if _, err = stmt.ExecContext(ctx); err != nil {
-		log.Printf("error while copying data: %s\n", err)
-		_ = tx.Rollback()
 		return err
 	}
 	if err = stmt.Close(); err != nil {
-		log.Printf("error during stmt.Close(): %s\n", err)
-		_ = tx.Rollback()
 		return err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	log.Println("--- Bulk Insert Complete ---")
-
 	return nil
 }
 
-func insertOne(conn *sql.Conn, ctx context.Context, table string, v interface{}) (interface{}, error) {
+func insertOne(ctx context.Context, db Executor, table string, v interface{}) (interface{}, error) {
+	return insertReturning(ctx, db, table, v, "")
+}
+
+// insertReturning inserts v and returns the stored row.  clause is written between the VALUES
+// list and RETURNING, for an ON CONFLICT clause.  When the clause causes no row to be returned
+// the result is nil.
+func insertReturning(ctx context.Context, db Executor, table string, v interface{}, clause string) (interface{}, error) {
 	// Assumption: v is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(v)
 	if err != nil {
 		return nil, err
 	}
-	stm, err := parseStructMetadata(v)
-	if err != nil {
-		return nil, err
-	}
 
-	var stmtColumns []string
-	for _, columnName := range scm.columnNames {
-		// We need to eliminate any key columns that are primarykey:serial
-		// so the database can default these values
-		// TODO perhaps a more robust approach is to assert in the type to use default?
-		if scm.columnKeyTypeMap[columnName] == "primarykey:serial" {
-			continue
-		}
-		stmtColumns = append(stmtColumns, columnName)
-	}
+	stmtColumns := insertColumns(scm)
 
-	// TODO... consider making this a standard parameterized exec
-	var stmtValues []string
-	for _, columnName := range stmtColumns {
-		fieldName := scm.columnNameFieldNameMap[columnName]
-		stmtValues = append(stmtValues, "'"+fmt.Sprintf("%v", stm.fieldNameValueMap[fieldName])+"'")
-	}
+	stmtRow, stmtValues := insertValuesRow(scm, stmtColumns, reflect.ValueOf(v).Elem(), nil)
 
 	// TODO Figure out how to get pointers to the key fields then construct the query
 	//  to return the key fields.  Then augment v and return it??
@@ -175,26 +307,56 @@ func insertOne(conn *sql.Conn, ctx context.Context, table string, v interface{})
 	//  the created record as a struct
 
 	stmt := `INSERT INTO ` + table + `
-             (` + strings.Join(stmtColumns, ", ") + `)
-		     VALUES (` + strings.Join(stmtValues, ", ") + `) ` +
+             (` + strings.Join(insertColumnList(scm, stmtColumns), ", ") + `)
+		     VALUES ` + stmtRow + ` ` +
+		clause +
 		`RETURNING *`
 
 	// Execute the Statement
-	rows, err := conn.QueryContext(ctx, stmt)
-	if err != nil {
+	results, err := queryStatement(ctx, db, OperationInsert, table, v, stmt, stmtValues...)
+	if err != nil || len(results) == 0 {
 		return nil, err
 	}
-	defer func() {
-		_ = rows.Close()
-	}()
 
-	var rowResult interface{}
-	for rows.Next() {
-		rowResult, err = unmarshalRowsResult(rows, v)
-		if err != nil {
-			return nil, err
+	return results[0], nil
+}
+
+// insertColumns returns the columns written by an insert.  Columns tagged primarykey:serial are
+// left out so the database can default them.
+func insertColumns(scm schemaMetadata) []string {
+	var columnNames []string
+	for _, columnName := range scm.columnNames {
+		// TODO perhaps a more robust approach is to assert in the type to use default?
+		if scm.columnKeyTypeMap[columnName] == "primarykey:serial" {
+			continue
 		}
+		columnNames = append(columnNames, columnName)
 	}
+	return columnNames
+}
 
-	return rowResult, nil
+// insertColumnList returns the column list of an INSERT statement writing stmtColumns.  When
+// every column is serial stmtColumns is empty, which Postgres doesn't accept, so every column
+// is listed and defaulted by insertValuesRow instead.
+func insertColumnList(scm schemaMetadata, stmtColumns []string) []string {
+	if len(stmtColumns) == 0 {
+		return scm.columnNames
+	}
+	return stmtColumns
+}
+
+// insertValuesRow returns the VALUES row of rv for an INSERT statement writing stmtColumns,
+// with the arguments it adds appended to stmtValues.
+func insertValuesRow(scm schemaMetadata, stmtColumns []string, rv reflect.Value,
+	stmtValues []interface{}) (string, []interface{}) {
+	if len(stmtColumns) == 0 {
+		return "(" + strings.TrimSuffix(strings.Repeat("DEFAULT, ", len(scm.columnNames)), ", ") + ")", stmtValues
+	}
+
+	var stmtPlaceholders []string
+	for _, columnName := range stmtColumns {
+		stmtValues = append(stmtValues, scm.columnArg(columnName, scm.columnValue(rv, columnName)))
+		stmtPlaceholders = append(stmtPlaceholders, "$"+strconv.Itoa(len(stmtValues)))
+	}
+	return "(" + strings.Join(stmtPlaceholders, ", ") + ")", stmtValues
 }
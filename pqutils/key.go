@@ -0,0 +1,35 @@
+package pqutils
+
+import "reflect"
+
+// primaryKeyWhere returns the where condition that selects the record identified by the
+// primarykey fields of v.  Every primary key field must hold a non-zero value, otherwise a
+// KeyError naming the zero fields is returned.
+func primaryKeyWhere(scm schemaMetadata, v interface{}) (Where, error) {
+	// Assumption: v is a pointer to a struct of the type scm was parsed from
+
+	if len(scm.primaryKeyColumns) == 0 {
+		return nil, &KeyError{Type: scm.schemaType}
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	where := make(Where)
+	var zeroFields []string
+	for _, columnName := range scm.primaryKeyColumns {
+		fieldName := scm.columnNameFieldNameMap[columnName]
+		fieldValue := scm.columnValue(rv, columnName)
+		if isZeroValue(fieldValue) {
+			zeroFields = append(zeroFields, fieldName)
+		}
+		where[fieldName] = fieldValue
+	}
+	if zeroFields != nil {
+		return nil, &KeyError{Type: scm.schemaType, ZeroFields: zeroFields}
+	}
+
+	return where, nil
+}
+
+func isZeroValue(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
@@ -0,0 +1,47 @@
+package pqutils
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Logger receives the log records of pqutils.  Its methods match those of *slog.Logger, so a
+// *slog.Logger can be passed to SetLogger as is.  args are alternating keys and values.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
+	WarnContext(ctx context.Context, msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
+}
+
+// loggerHolder wraps the Logger so atomic.Value always stores the same concrete type
+type loggerHolder struct {
+	logger Logger
+}
+
+var packageLogger atomic.Value
+
+// SetLogger sets the Logger used by every function of pqutils.  Each statement is logged at
+// debug level, or at warn level when it fails, with its SQL text, duration and row count as
+// fields.  Statement arguments are never logged.  A nil logger, the default, discards
+// everything.
+func SetLogger(logger Logger) {
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	packageLogger.Store(loggerHolder{logger: logger})
+}
+
+func currentLogger() Logger {
+	if holder, ok := packageLogger.Load().(loggerHolder); ok {
+		return holder.logger
+	}
+	return discardLogger{}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) DebugContext(context.Context, string, ...any) {}
+func (discardLogger) InfoContext(context.Context, string, ...any)  {}
+func (discardLogger) WarnContext(context.Context, string, ...any)  {}
+func (discardLogger) ErrorContext(context.Context, string, ...any) {}
@@ -0,0 +1,296 @@
+package pqutils
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Page is one page of results from SelectPage.  NextCursor and PrevCursor are opaque tokens
+// to pass back as QueryOptions.Cursor to fetch the following or the preceding page.  They are
+// empty when there is no such page.
+type Page struct {
+	Results    []interface{}
+	NextCursor string
+	PrevCursor string
+}
+
+// cursorNext and cursorPrev are the directions a cursor continues in
+const cursorNext = "next"
+const cursorPrev = "prev"
+
+// pageCursor is the decoded form of a cursor token.  It holds the ordering the page was built
+// with and the ordering column values of the row the next page continues from.
+type pageCursor struct {
+	Direction string            `json:"d"`
+	OrderBy   []string          `json:"o"`
+	Values    []json.RawMessage `json:"v"`
+}
+
+// SelectPage returns one page of the records matching where using keyset pagination.  Rows are
+// ordered by options.OrderBy followed by any primary key columns it doesn't name, which keeps
+// the order total so no row is skipped or repeated between pages.  options.Limit is the page
+// size, and options.Cursor is empty for the first page or a cursor from a previous Page.
+// Offset can't be combined with a cursor, and ordering columns must not hold NULLs.  When
+// options.Columns is set the ordering fields are selected as well.
+//
+// SelectAllWithOptions also accepts options.Cursor, returning only the Results of the page.
+func SelectPage(db Executor, table string, schema interface{}, where Filter, options QueryOptions) (Page, error) {
+	return SelectPageContext(context.Background(), db, table, schema, where, options)
+}
+
+// SelectPageContext is SelectPage with a caller supplied context.
+func SelectPageContext(ctx context.Context, db Executor, table string, schema interface{}, where Filter,
+	options QueryOptions) (Page, error) {
+	page, err := selectPage(ctx, db, table, schema, where, options)
+	return page, contextError(ctx, err)
+}
+
+func selectPage(ctx context.Context, db Executor, table string, schema interface{}, where Filter,
+	options QueryOptions) (Page, error) {
+	// Assumption: schema is a pointer to a struct
+
+	if options.Limit <= 0 {
+		return Page{}, errors.New("invalid QueryOptions.Limit for cursor pagination: must be greater than zero: " +
+			strconv.Itoa(options.Limit))
+	}
+	if options.Offset != 0 {
+		return Page{}, errors.New("invalid QueryOptions.Offset for cursor pagination: must be zero")
+	}
+
+	scm, err := parseSchemaMetadata(schema)
+	if err != nil {
+		return Page{}, err
+	}
+	stm, err := parseStructMetadata(schema)
+	if err != nil {
+		return Page{}, err
+	}
+	b := &conditionBuilder{scm: scm, stm: stm}
+
+	// Order by the requested columns, then by the primary key to break ties
+	var items []orderItem
+	orderedColumns := make(map[string]bool)
+	for _, orderBy := range options.OrderBy {
+		item, err := b.orderItem(orderBy)
+		if err != nil {
+			return Page{}, err
+		}
+		items = append(items, item)
+		orderedColumns[item.columnName] = true
+	}
+	for _, columnName := range scm.primaryKeyColumns {
+		if !orderedColumns[columnName] {
+			items = append(items, orderItem{fieldName: scm.columnNameFieldNameMap[columnName], columnName: columnName})
+		}
+	}
+	if len(items) == 0 {
+		return Page{}, errors.New("invalid QueryOptions.OrderBy for cursor pagination: " +
+			"OrderBy must be set when " + scm.schemaType.String() + " has no primarykey fields")
+	}
+	var orderBy []string
+	for _, item := range items {
+		orderBy = append(orderBy, item.option())
+	}
+
+	direction := cursorNext
+	var values []interface{}
+	if options.Cursor != "" {
+		direction, values, err = decodeCursor(scm, options.Cursor, orderBy, items)
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	// A previous page is read backwards from the cursor, then put back in order
+	queryItems := items
+	if direction == cursorPrev {
+		queryItems = make([]orderItem, len(items))
+		for i, item := range items {
+			queryItems[i] = item.reversed()
+		}
+	}
+	queryOptions := QueryOptions{Limit: options.Limit + 1}
+	for _, item := range queryItems {
+		queryOptions.OrderBy = append(queryOptions.OrderBy, item.option())
+	}
+	if len(options.Columns) > 0 {
+		// The cursors are built from the ordering fields, so they are always selected
+		queryOptions.Columns = append([]string(nil), options.Columns...)
+		for _, item := range items {
+			queryOptions.Columns = append(queryOptions.Columns, item.fieldName)
+		}
+	}
+	filter := where
+	if values != nil {
+		keyset := keysetFilter{items: queryItems, values: values}
+		if where != nil {
+			filter = And(where, keyset)
+		} else {
+			filter = keyset
+		}
+	}
+
+	results, err := selectAllWithOptions(ctx, db, table, schema, filter, queryOptions)
+	if err != nil {
+		return Page{}, err
+	}
+	more := len(results) > options.Limit
+	if more {
+		results = results[:options.Limit]
+	}
+	if direction == cursorPrev {
+		for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+			results[i], results[j] = results[j], results[i]
+		}
+	}
+
+	// There is a next page when more rows follow, or when this page was reached going
+	// backwards.  There is a previous page when more rows precede it, or when it was reached
+	// going forwards from a cursor.
+	page := Page{Results: results}
+	if len(results) == 0 {
+		return page, nil
+	}
+	if more || direction == cursorPrev {
+		page.NextCursor, err = encodeCursor(scm, cursorNext, orderBy, items, results[len(results)-1])
+		if err != nil {
+			return Page{}, err
+		}
+	}
+	if (more && direction == cursorPrev) || (direction == cursorNext && options.Cursor != "") {
+		page.PrevCursor, err = encodeCursor(scm, cursorPrev, orderBy, items, results[0])
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// option returns the item in the QueryOptions.OrderBy format.
+func (o orderItem) option() string {
+	option := o.fieldName + ":" + OrderAscending
+	if o.descending {
+		option = o.fieldName + ":" + OrderDescending
+	}
+	if o.nulls != "" {
+		option += ":" + o.nulls
+	}
+	return option
+}
+
+// reversed returns the item with the opposite order, which also moves NULLs to the other end.
+func (o orderItem) reversed() orderItem {
+	o.descending = !o.descending
+	switch o.nulls {
+	case NullsFirst:
+		o.nulls = NullsLast
+	case NullsLast:
+		o.nulls = NullsFirst
+	}
+	return o
+}
+
+// keysetFilter matches the rows that sort after values in the order given by items.  For
+// columns a ASC, b DESC that is:  a > $1 OR (a = $1 AND b < $2)
+type keysetFilter struct {
+	items  []orderItem
+	values []interface{}
+}
+
+func (f keysetFilter) condition(b *conditionBuilder) (string, error) {
+	var placeholders []string
+	var conditions []string
+	for i, item := range f.items {
+		placeholders = append(placeholders, b.placeholder(item.columnName, f.values[i]))
+
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, f.items[j].columnName+" = "+placeholders[j])
+		}
+		operator := " > "
+		if item.descending {
+			operator = " < "
+		}
+		terms = append(terms, item.columnName+operator+placeholders[i])
+		conditions = append(conditions, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return strings.Join(conditions, " OR "), nil
+}
+
+// encodeCursor returns the cursor token that continues in direction from row.
+func encodeCursor(scm schemaMetadata, direction string, orderBy []string, items []orderItem,
+	row interface{}) (string, error) {
+	c := pageCursor{Direction: direction, OrderBy: orderBy}
+	rv := reflect.ValueOf(row)
+	for _, item := range items {
+		value := scm.columnValue(rv, item.columnName)
+		if isNullArg(scm.columnArg(item.columnName, value)) {
+			return "", errors.New("invalid ordering for cursor pagination: NULL value in ordering field " +
+				item.fieldName)
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, b)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the direction and the ordering column values of a cursor token.  The
+// values are decoded into the types of their fields, and the cursor must have been created
+// with the same ordering.
+func decodeCursor(scm schemaMetadata, token string, orderBy []string, items []orderItem) (string,
+	[]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", nil, errors.New("invalid cursor: " + err.Error())
+	}
+	var c pageCursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return "", nil, errors.New("invalid cursor: " + err.Error())
+	}
+	if c.Direction != cursorNext && c.Direction != cursorPrev {
+		return "", nil, errors.New("invalid cursor: unknown direction " + c.Direction)
+	}
+	if !reflect.DeepEqual(c.OrderBy, orderBy) || len(c.Values) != len(items) {
+		return "", nil, errors.New("invalid cursor: created with a different ordering: " +
+			strings.Join(c.OrderBy, ", "))
+	}
+
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		value := reflect.New(scm.columnNameFieldTypeMap[item.columnName])
+		if err = json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return "", nil, errors.New("invalid cursor: value for " + item.fieldName + ": " + err.Error())
+		}
+		values[i] = value.Elem().Interface()
+		if isNullArg(scm.columnArg(item.columnName, values[i])) {
+			return "", nil, errors.New("invalid cursor: NULL value for " + item.fieldName)
+		}
+	}
+
+	return c.Direction, values, nil
+}
+
+// isNullArg reports whether the statement argument arg is written as NULL.
+func isNullArg(arg interface{}) bool {
+	if valuer, ok := arg.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		return err == nil && value == nil
+	}
+	return arg == nil
+}
@@ -2,117 +2,70 @@ package pqutils
 
 import (
 	"errors"
-	"fmt"
-	"reflect"
 	"strconv"
 	"strings"
 )
 
 const OrderAscending = "ASC"
 const OrderDescending = "DESC"
+const NullsFirst = "NULLS FIRST"
+const NullsLast = "NULLS LAST"
 
 type QueryOptions struct {
 	OrderBy []string
 	Limit   int
 	Offset  int
+
+	// Columns limits a select to the named fields, given as struct field names or json names
+	// with a "json:" prefix.  The other fields of the results are left zero.  Empty selects
+	// every column.
+	Columns []string
+
+	// Cursor continues a keyset paginated select from a cursor returned in a Page.  See
+	// SelectPage.
+	Cursor string
 }
 
-func queryConditionString(schema interface{}, where map[string]interface{}, options QueryOptions) (string, error) {
+// queryConditionString builds the WHERE and options clauses for a statement.  Values in where
+// are never written into the SQL text; each one is replaced by a $n placeholder and appended
+// to args, so the placeholders continue numbering after any arguments the caller already has.
+// The returned slice holds the caller's args followed by the condition values.
+func queryConditionString(schema interface{}, where Filter, options QueryOptions,
+	args []interface{}) (string, []interface{}, error) {
 	// Assumption: schema is a pointer to a struct
 
-	if where == nil {
-		return "", nil
-	}
-
 	scm, err := parseSchemaMetadata(schema)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	stm, err := parseStructMetadata(schema)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
+	b := &conditionBuilder{scm: scm, stm: stm, args: args}
 	var conditionString string
-	var conditionValues []string
-	for fieldName, fieldValue := range where {
-		if fieldValue != "" {
-			if strings.HasPrefix(fieldName, "json:") {
-				fieldName = stm.jsonNameFieldNameMap[strings.TrimPrefix(fieldName, "json:")]
-			}
-			columnName := scm.fieldNameColumnNameMap[fieldName]
-			fieldKind := scm.columnNameFieldKindMap[columnName]
-			var condition string
-			if fieldKind == reflect.Int || fieldKind == reflect.Int64 {
-				condition = columnName + "=" + fmt.Sprintf("%v", fieldValue)
-			} else {
-				condition = columnName + "='" + fmt.Sprintf("%v", fieldValue) + "'"
-			}
-			conditionValues = append(conditionValues, condition)
+	if where != nil {
+		condition, err := where.condition(b)
+		if err != nil {
+			return "", nil, err
+		}
+		if condition != "" {
+			conditionString = "WHERE " + condition
 		}
-	}
-
-	if conditionValues != nil {
-		conditionString = "WHERE " + strings.Join(conditionValues, " AND ")
 	}
 
 	var optionsString string
+	var orderByStrings []string
 	for _, orderBy := range options.OrderBy {
-		// orderBy can have the struct field name or the json fieldName with the order value
-		// in colon delimited format
-		//
-		// Examples:  FirstName:asc  json:firstName:DESC  FirstName
-		//
-		// If json is not specified, assume struct field name.  The value of orderValue can either be
-		// asc (ascending) or desc (descending) and we can ignore case.  If no orderValue is present assume asc
-		//
-		// Split orderBy into tokens, and normalize format to <StructField>:<OrderValue>
-		// If len 1: parse it as the struct field name, and add ":asc" to the orderBy string
-		// If len 2: check if first token is json:; If json, then translate second token to struct field and add ":asc"
-		//           If NOT, then we have <StructField>:<OrderValue> format
-		// If len 3: Check if first token is json:; If json, then translate first token to struct field name and keep
-		//           the third token as the order value
-		//           If NOT, then this is an error
-		//
-		// After constructing a normalized format, tokenize and validate
-
-		var orderByString string
-		tokens := strings.Split(orderBy, ":")
-		switch len(tokens) {
-		case 1:
-			orderByString = orderBy + ":" + OrderAscending
-		case 2:
-			if tokens[0] == "json:" {
-				orderByString = stm.jsonNameFieldNameMap[tokens[1]] + ":" + OrderAscending
-			} else {
-				orderByString = orderBy
-			}
-		case 3:
-			if tokens[0] == "json:" {
-				orderByString = stm.jsonNameFieldNameMap[tokens[1]] + ":" + strings.ToUpper(tokens[2])
-				break
-			}
-			// Just fall through to error if first token is not json:
-			fallthrough
-		default:
-			return "", errors.New("invalid format for QueryOptions.OrderBy: " + orderBy)
-		}
-
-		// We should now have <StructField>:<OrderValue>, so validate and process
-		tokens = strings.Split(orderByString, ":")
-		if _, ok := scm.fieldNameColumnNameMap[tokens[0]]; !ok {
-			return "", errors.New("invalid fieldName for QueryOptions.OrderBy: " + orderBy)
+		item, err := b.orderItem(orderBy)
+		if err != nil {
+			return "", nil, err
 		}
-		if tokens[1] != OrderAscending && tokens[1] != OrderDescending {
-			return "", errors.New("invalid ordering for QueryOptions.OrderBy. Must be 'asc' or 'desc': " + orderBy)
-		}
-
-		columnName := scm.fieldNameColumnNameMap[tokens[0]]
-		orderValue := tokens[1]
-		optionsString += ` ORDER BY ` + columnName + " " + orderValue
-
-		// TODO For first version we will only loop once to take the first value, then upgrade for multi column
-		break
+		orderByStrings = append(orderByStrings, item.sql())
+	}
+	if orderByStrings != nil {
+		optionsString += ` ORDER BY ` + strings.Join(orderByStrings, ", ")
 	}
 	if options.Limit > 0 {
 		optionsString += ` LIMIT ` + strconv.Itoa(options.Limit)
@@ -121,5 +74,86 @@ func queryConditionString(schema interface{}, where map[string]interface{}, opti
 		optionsString += ` OFFSET ` + strconv.Itoa(options.Offset)
 	}
 
-	return conditionString + optionsString, nil
+	return conditionString + optionsString, b.args, nil
+}
+
+// orderItem is one parsed entry of QueryOptions.OrderBy
+type orderItem struct {
+	fieldName  string
+	columnName string
+	descending bool
+	nulls      string
+}
+
+// sql returns the item as it appears in an ORDER BY clause.
+func (o orderItem) sql() string {
+	orderValue := OrderAscending
+	if o.descending {
+		orderValue = OrderDescending
+	}
+	if o.nulls != "" {
+		return o.columnName + " " + orderValue + " " + o.nulls
+	}
+	return o.columnName + " " + orderValue
+}
+
+// orderItem parses one entry of QueryOptions.OrderBy.  The entry names a struct field, or a
+// json name with a "json:" prefix, optionally followed by colon delimited modifiers: the
+// order, asc or desc, and where NULLs sort, nulls first or nulls last.  The modifiers ignore
+// case and the order defaults to ascending.
+//
+// Examples:  FirstName  FirstName:desc  json:firstName:DESC  LastName:asc:nulls last
+func (b *conditionBuilder) orderItem(orderBy string) (orderItem, error) {
+	tokens := strings.Split(orderBy, ":")
+	name := tokens[0]
+	if name == "json" && len(tokens) > 1 {
+		name = "json:" + tokens[1]
+		tokens = tokens[1:]
+	}
+	fieldName, err := b.fieldName(name)
+	if err != nil {
+		return orderItem{}, errors.New("invalid fieldName for QueryOptions.OrderBy: " + orderBy)
+	}
+	item := orderItem{fieldName: fieldName, columnName: b.scm.fieldNameColumnNameMap[fieldName]}
+
+	for i, token := range tokens[1:] {
+		modifier := strings.ToUpper(strings.Join(strings.Fields(token), " "))
+		switch {
+		case i == 0 && (modifier == OrderAscending || modifier == OrderDescending):
+			item.descending = modifier == OrderDescending
+		case item.nulls == "" && (modifier == NullsFirst || modifier == NullsLast):
+			item.nulls = modifier
+		default:
+			return orderItem{}, errors.New("invalid ordering for QueryOptions.OrderBy. Must be 'asc' or 'desc', " +
+				"optionally followed by 'nulls first' or 'nulls last': " + orderBy)
+		}
+	}
+
+	return item, nil
+}
+
+// selectColumns returns the columns read by a select with options: every column of the
+// schema, or only those named in options.Columns.  Either way they are in schema order.
+func selectColumns(scm schemaMetadata, stm structMetadata, options QueryOptions) ([]string, error) {
+	if len(options.Columns) == 0 {
+		return scm.columnNames, nil
+	}
+
+	b := &conditionBuilder{scm: scm, stm: stm}
+	selected := make(map[string]bool, len(options.Columns))
+	for _, name := range options.Columns {
+		columnName, err := b.columnName(name)
+		if err != nil {
+			return nil, errors.New("invalid fieldName for QueryOptions.Columns: " + name)
+		}
+		selected[columnName] = true
+	}
+
+	var columnNames []string
+	for _, columnName := range scm.columnNames {
+		if selected[columnName] {
+			columnNames = append(columnNames, columnName)
+		}
+	}
+	return columnNames, nil
 }
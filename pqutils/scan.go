@@ -0,0 +1,229 @@
+package pqutils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// assignColumn stores src, a value returned by the driver for one column of a row, in field.
+// The driver hands back int64, float64, bool, string, []byte or time.Time depending on the
+// Postgres type, so each destination kind accepts every source that converts to it without
+// losing information.  NUMERIC, UUID, JSONB and the other types the driver does not decode
+// arrive as []byte text and are parsed here.  Fields whose pointer implements sql.Scanner
+// are left to scan themselves, and slices other than []byte are parsed as Postgres arrays.
+// NULL can only be stored in pointer fields, which are set to nil, in slices, and in
+// sql.Scanner types such as sql.NullString.
+func assignColumn(field reflect.Value, src interface{}, columnName string, columnTypeName string) error {
+	fail := func(err error) error {
+		return &ScanError{
+			Column:       columnName,
+			DatabaseType: columnTypeName,
+			FieldType:    field.Type(),
+			Err:          err,
+		}
+	}
+
+	if field.CanAddr() && field.Addr().Type().Implements(scannerType) {
+		if err := field.Addr().Interface().(sql.Scanner).Scan(src); err != nil {
+			return fail(err)
+		}
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		// Nullable fields: NULL leaves the pointer nil, anything else is stored in a new value
+		if src == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		value := reflect.New(field.Type().Elem())
+		if err := assignColumn(value.Elem(), src, columnName, columnTypeName); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+
+	if src == nil {
+		if field.Kind() == reflect.Slice {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		return fail(errors.New("NULL value in a field that is not a pointer or sql.Null* type"))
+	}
+
+	if field.Type() == timeType {
+		switch s := src.(type) {
+		case time.Time:
+			field.Set(reflect.ValueOf(s))
+			return nil
+		case []byte:
+			t, err := time.Parse(time.RFC3339Nano, string(s))
+			if err != nil {
+				return fail(err)
+			}
+			field.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return fail(nil)
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch s := src.(type) {
+		case int64:
+			i = s
+		case float64:
+			if s != math.Trunc(s) || s < math.MinInt64 || s > math.MaxInt64 {
+				return fail(errors.New("value " + strconv.FormatFloat(s, 'g', -1, 64) + " is not an integer"))
+			}
+			i = int64(s)
+		case []byte:
+			var err error
+			if i, err = strconv.ParseInt(string(s), 10, 64); err != nil {
+				return fail(err)
+			}
+		case string:
+			var err error
+			if i, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return fail(err)
+			}
+		default:
+			return fail(nil)
+		}
+		if field.OverflowInt(i) {
+			return fail(errors.New("value " + strconv.FormatInt(i, 10) + " overflows field"))
+		}
+		field.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch s := src.(type) {
+		case int64:
+			if s < 0 {
+				return fail(errors.New("negative value " + strconv.FormatInt(s, 10)))
+			}
+			u = uint64(s)
+		case []byte:
+			var err error
+			if u, err = strconv.ParseUint(string(s), 10, 64); err != nil {
+				return fail(err)
+			}
+		default:
+			return fail(nil)
+		}
+		if field.OverflowUint(u) {
+			return fail(errors.New("value " + strconv.FormatUint(u, 10) + " overflows field"))
+		}
+		field.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch s := src.(type) {
+		case float64:
+			f = s
+		case int64:
+			f = float64(s)
+		case []byte:
+			var err error
+			if f, err = strconv.ParseFloat(string(s), 64); err != nil {
+				return fail(err)
+			}
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(s, 64); err != nil {
+				return fail(err)
+			}
+		default:
+			return fail(nil)
+		}
+		if field.OverflowFloat(f) {
+			return fail(errors.New("value " + strconv.FormatFloat(f, 'g', -1, 64) + " overflows field"))
+		}
+		field.SetFloat(f)
+
+	case reflect.Bool:
+		switch s := src.(type) {
+		case bool:
+			field.SetBool(s)
+		case []byte:
+			b, err := strconv.ParseBool(string(s))
+			if err != nil {
+				return fail(err)
+			}
+			field.SetBool(b)
+		default:
+			return fail(nil)
+		}
+
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			field.SetString(s)
+		case []byte:
+			field.SetString(string(s))
+		case int64:
+			field.SetString(strconv.FormatInt(s, 10))
+		case float64:
+			field.SetString(strconv.FormatFloat(s, 'g', -1, 64))
+		case bool:
+			field.SetString(strconv.FormatBool(s))
+		case time.Time:
+			field.SetString(s.Format(time.RFC3339Nano))
+		default:
+			return fail(nil)
+		}
+
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			if err := scanArray(field, src); err != nil {
+				return fail(err)
+			}
+			return nil
+		}
+		switch s := src.(type) {
+		case []byte:
+			field.SetBytes(append([]byte(nil), s...))
+		case string:
+			field.SetBytes([]byte(s))
+		default:
+			return fail(nil)
+		}
+
+	default:
+		return fail(errors.New("unsupported field type"))
+	}
+
+	return nil
+}
+
+// assignJSONBColumn unmarshals src, the JSON text of a JSONB column, into field.  NULL leaves
+// the field at its zero value.
+func assignJSONBColumn(field reflect.Value, src interface{}, columnName string, columnTypeName string) error {
+	var b []byte
+	switch s := src.(type) {
+	case nil:
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		return &ScanError{Column: columnName, DatabaseType: columnTypeName, FieldType: field.Type()}
+	}
+
+	if err := json.Unmarshal(b, field.Addr().Interface()); err != nil {
+		return &ScanError{Column: columnName, DatabaseType: columnTypeName, FieldType: field.Type(), Err: err}
+	}
+	return nil
+}
@@ -2,10 +2,10 @@ package pqutils
 
 import (
 	"database/sql"
-	"errors"
 	_ "github.com/lib/pq"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 func SchemaColumnNames(schema interface{}) ([]string, error) {
@@ -16,11 +16,25 @@ func SchemaColumnNames(schema interface{}) ([]string, error) {
 		return nil, err
 	}
 
-	return sm.columnNames, nil
+	// Copy so the caller can't reorder the cached metadata
+	return append([]string(nil), sm.columnNames...), nil
 }
 
-func unmarshalRowsResult(rows *sql.Rows, schema interface{}) (interface{}, error) {
-	// Assumption: v is a pointer to a struct
+// rowsUnmarshaler converts the rows of a result set into values of the schema type.  The
+// result columns are matched to struct fields once, when the unmarshaler is created, so
+// each row only pays for the scan and the field assignments.
+type rowsUnmarshaler struct {
+	schemaType      reflect.Type
+	columnNames     []string
+	columnTypeNames []string
+	fieldIndexes    [][]int
+	jsonb           []bool
+	values          []interface{}
+	scanArgs        []interface{}
+}
+
+func newRowsUnmarshaler(rows *sql.Rows, schema interface{}) (*rowsUnmarshaler, error) {
+	// Assumption: schema is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(schema)
 	if err != nil {
@@ -32,44 +46,136 @@ func unmarshalRowsResult(rows *sql.Rows, schema interface{}) (interface{}, error
 		return nil, err
 	}
 
-	var sd []interface{}
-	for range columnTypes {
-		// TODO add code for the array test case when we get an array back from postgres
-		// sd = append(sd, pq.Array(field.Addr().Interface()))
-		var v interface{}
-		sd = append(sd, &v)
+	u := rowsUnmarshaler{
+		schemaType:      reflect.Indirect(reflect.ValueOf(schema)).Type(),
+		columnNames:     make([]string, len(columnTypes)),
+		columnTypeNames: make([]string, len(columnTypes)),
+		fieldIndexes:    make([][]int, len(columnTypes)),
+		jsonb:           make([]bool, len(columnTypes)),
+		values:          make([]interface{}, len(columnTypes)),
+		scanArgs:        make([]interface{}, len(columnTypes)),
+	}
+	for i, columnType := range columnTypes {
+		u.columnNames[i] = columnType.Name()
+		u.columnTypeNames[i] = columnType.DatabaseTypeName()
+		// A column the schema does not map, e.g. from RETURNING *, keeps a nil index and is skipped
+		u.fieldIndexes[i] = scm.columnNameFieldIndexMap[columnType.Name()]
+		u.jsonb[i] = scm.columnJSONBMap[columnType.Name()]
+		u.scanArgs[i] = &u.values[i]
 	}
-	err = rows.Scan(sd...)
+
+	return &u, nil
+}
+
+// unmarshal scans the current row of rows and returns it as a value of the schema type
+func (u *rowsUnmarshaler) unmarshal(rows *sql.Rows) (interface{}, error) {
+	err := rows.Scan(u.scanArgs...)
 	if err != nil {
 		return nil, err
 	}
 
-	schemaType := reflect.Indirect(reflect.ValueOf(schema)).Type()
-	rowResult := reflect.New(schemaType)
-	for i, columnType := range columnTypes {
-		columnName := columnType.Name()
-		columnTypeName := columnType.DatabaseTypeName()
-		switch columnTypeName {
-		case "INT4":
-			rowResult.Elem().FieldByName(scm.columnNameFieldNameMap[columnName]).SetInt((*sd[i].(*interface{})).(int64))
-		case "VARCHAR":
-			rowResult.Elem().FieldByName(scm.columnNameFieldNameMap[columnName]).SetString((*sd[i].(*interface{})).(string))
-		default:
-			return nil, errors.New("scan error: unhandled type: " + columnTypeName)
+	rowResult := reflect.New(u.schemaType).Elem()
+	for i, fieldIndex := range u.fieldIndexes {
+		if fieldIndex == nil {
+			continue
 		}
+		field := fieldByIndexAlloc(rowResult, fieldIndex)
+		if u.jsonb[i] {
+			err = assignJSONBColumn(field, u.values[i], u.columnNames[i], u.columnTypeNames[i])
+		} else {
+			err = assignColumn(field, u.values[i], u.columnNames[i], u.columnTypeNames[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rowResult.Interface(), nil
+}
+
+// nullBaseTypes maps the sql.Null* types to the Go type of the value they hold
+var nullBaseTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+	reflect.TypeOf(sql.NullByte{}):    reflect.TypeOf(byte(0)),
+	reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+	reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+	reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+	reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+	reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+	reflect.TypeOf(sql.NullTime{}):    timeType,
+}
+
+// columnBaseType returns the type that decides the column type of a field of type t, and
+// whether the column is nullable.  Pointer fields and sql.Null* fields are nullable and take
+// the column type of the value they point to or hold.
+func columnBaseType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem(), true
+	}
+	if baseType, ok := nullBaseTypes[t]; ok {
+		return baseType, true
 	}
-	return rowResult.Elem().Interface(), nil
+	return t, false
 }
 
 type schemaMetadata struct {
-	fieldNames             []string
-	fieldNameColumnNameMap map[string]string
-	columnNames            []string
-	columnNameFieldNameMap map[string]string
-	columnNameFieldKindMap map[string]reflect.Kind
-	columnKeyTypeMap       map[string]string
+	schemaType              reflect.Type
+	fieldNames              []string
+	fieldNameColumnNameMap  map[string]string
+	columnNames             []string
+	columnNameFieldNameMap  map[string]string
+	columnNameFieldTypeMap  map[string]reflect.Type
+	columnNameFieldIndexMap map[string][]int
+	columnKeyTypeMap        map[string]string
+	columnJSONBMap          map[string]bool
+	primaryKeyColumns       []string
+}
+
+// columnValue returns the value of the field of rv that maps to columnName.  rv must be a
+// struct value of the type the metadata was parsed from.  A field inside a nil embedded
+// pointer reads as the zero value of its type.
+func (scm schemaMetadata) columnValue(rv reflect.Value, columnName string) interface{} {
+	fieldIndex := scm.columnNameFieldIndexMap[columnName]
+	for i, x := range fieldIndex {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Zero(scm.columnNameFieldTypeMap[columnName]).Interface()
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv.Interface()
 }
 
+// columnArg converts value, a value for columnName, into a statement argument.  JSONB columns
+// are marshalled with encoding/json, everything else goes through driverValue.
+func (scm schemaMetadata) columnArg(columnName string, value interface{}) interface{} {
+	if scm.columnJSONBMap[columnName] {
+		return jsonbValue{value}
+	}
+	return driverValue(value)
+}
+
+// fieldByIndexAlloc is reflect.Value.FieldByIndex for a settable rv, except that nil embedded
+// pointers along the way are allocated instead of causing a panic.
+func fieldByIndexAlloc(rv reflect.Value, fieldIndex []int) reflect.Value {
+	for i, x := range fieldIndex {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv
+}
+
+// schemaMetadataCache holds the schemaMetadata already parsed for each struct type.  The
+// metadata only depends on the type, so it is parsed once and shared; callers must treat
+// it as read only.
+var schemaMetadataCache sync.Map
+
 // parseSchemaMetadata reutrns a schemaMetadata object for the passed value v
 //
 // NOTE: If v is truly passed as an interface (i.e. caller receives v as an interface
@@ -83,54 +189,254 @@ func parseSchemaMetadata(v interface{}) (schemaMetadata, error) {
 	// Check that v is a pointer to a struct
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return schemaMetadata{}, errors.New("invalid type: must be a non-nil pointer to a struct: " + reflect.TypeOf(v).String())
+		return schemaMetadata{}, &InvalidTypeError{RequiredType: "StructPtr", InvalidType: reflect.TypeOf(v)}
 	}
 	if reflect.Indirect(rv).Kind() != reflect.Struct {
-		return schemaMetadata{}, errors.New("invalid type: must be a non-nil pointer to a struct: " + reflect.TypeOf(v).String())
+		return schemaMetadata{}, &InvalidTypeError{RequiredType: "StructPtr", InvalidType: reflect.TypeOf(v)}
+	}
+
+	schemaType := rv.Elem().Type()
+	if cached, ok := schemaMetadataCache.Load(schemaType); ok {
+		return cached.(schemaMetadata), nil
 	}
 
-	rve := rv.Elem()
+	scm := parseSchemaType(schemaType)
+	schemaMetadataCache.Store(schemaType, scm)
 
-	var scm schemaMetadata
-	for i := 0; i < rve.NumField(); i++ {
-		structField := rve.Type().Field(i)
-		if tagValue, ok := structField.Tag.Lookup("sql"); ok && tagValue != "" {
-			fieldName := structField.Name
-			tokens := strings.Split(tagValue, ",")
-			columnName := tokens[0]
+	return scm, nil
+}
 
-			if scm.fieldNameColumnNameMap == nil {
-				scm.fieldNameColumnNameMap = make(map[string]string)
+func parseSchemaType(schemaType reflect.Type) schemaMetadata {
+	scm := schemaMetadata{schemaType: schemaType}
+	for _, field := range dominantSchemaFields(collectSchemaFields(schemaType, nil, "", "", 0, nil)) {
+		if field.columnName == "" {
+			continue
+		}
+		fieldName := field.fieldName
+		columnName := field.columnName
+
+		if scm.fieldNameColumnNameMap == nil {
+			scm.fieldNameColumnNameMap = make(map[string]string)
+		}
+		if scm.columnNameFieldNameMap == nil {
+			scm.columnNameFieldNameMap = make(map[string]string)
+		}
+		if scm.columnNameFieldTypeMap == nil {
+			scm.columnNameFieldTypeMap = make(map[string]reflect.Type)
+		}
+		if scm.columnNameFieldIndexMap == nil {
+			scm.columnNameFieldIndexMap = make(map[string][]int)
+		}
+
+		scm.fieldNames = append(scm.fieldNames, fieldName)
+		scm.fieldNameColumnNameMap[fieldName] = columnName
+		scm.columnNames = append(scm.columnNames, columnName)
+		scm.columnNameFieldNameMap[columnName] = fieldName
+		scm.columnNameFieldTypeMap[columnName] = field.fieldType
+		scm.columnNameFieldIndexMap[columnName] = field.index
+
+		if field.jsonb {
+			if scm.columnJSONBMap == nil {
+				scm.columnJSONBMap = make(map[string]bool)
 			}
-			if scm.columnNameFieldNameMap == nil {
-				scm.columnNameFieldNameMap = make(map[string]string)
+			scm.columnJSONBMap[columnName] = true
+		}
+		if field.keyType != "" {
+			if scm.columnKeyTypeMap == nil {
+				scm.columnKeyTypeMap = make(map[string]string)
 			}
-			if scm.columnNameFieldKindMap == nil {
-				scm.columnNameFieldKindMap = make(map[string]reflect.Kind)
+			scm.columnKeyTypeMap[columnName] = field.keyType
+			if strings.HasPrefix(field.keyType, "primarykey") {
+				scm.primaryKeyColumns = append(scm.primaryKeyColumns, columnName)
 			}
+		}
+	}
 
-			scm.fieldNames = append(scm.fieldNames, fieldName)
-			scm.fieldNameColumnNameMap[fieldName] = columnName
-			scm.columnNames = append(scm.columnNames, columnName)
-			scm.columnNameFieldNameMap[columnName] = fieldName
-			scm.columnNameFieldKindMap[columnName] = structField.Type.Kind()
-
-			if len(tokens) > 1 {
-				if scm.columnKeyTypeMap == nil {
-					scm.columnKeyTypeMap = make(map[string]string)
-				}
-				keyType := strings.Join(tokens[1:], ":")
-				switch keyType {
-				case "primarykey":
-					fallthrough
-				case "primarykey:serial":
-					fallthrough
-				case "unique":
-					scm.columnKeyTypeMap[columnName] = keyType
-				}
+	return scm
+}
+
+// schemaField is a field found while walking a struct type and the structs flattened into it.
+// Fields without an sql tag have an empty columnName; they are kept only because they can
+// shadow promoted fields of the same name.
+type schemaField struct {
+	fieldName  string
+	columnName string
+	keyType    string
+	jsonb      bool
+	fieldType  reflect.Type
+	index      []int
+	depth      int
+}
+
+// collectSchemaFields returns the fields of t in declaration order, descending into the
+// structs that are flattened into the column set:
+//
+//   - embedded structs and pointers to structs without a column name, e.g. an untagged
+//     Timestamps embedded in a model.  Their fields are promoted and keep their own names.
+//   - named struct fields tagged with a prefix and no column name, e.g.
+//     Home Address `sql:",prefix=home_"`.  Their fields are named Home.Street and so on.
+//
+// A prefix option on either kind is prepended to the column names of the nested fields.
+func collectSchemaFields(t reflect.Type, index []int, fieldPrefix string, columnPrefix string, depth int,
+	visiting map[reflect.Type]bool) []schemaField {
+	if visiting[t] {
+		// A struct that embeds itself through a pointer would never finish
+		return nil
+	}
+	visiting = copyVisiting(visiting)
+	visiting[t] = true
+
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tagValue, tagged := structField.Tag.Lookup("sql")
+		if tagValue == "-" {
+			continue
+		}
+		if structField.PkgPath != "" && !(structField.Anonymous && structField.Type.Kind() == reflect.Struct) {
+			// Unexported fields can't be read or set.  Embedded unexported structs are the exception,
+			// since their exported fields are promoted.
+			continue
+		}
+		tag := parseSQLTag(tagValue)
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		nestedType := structField.Type
+		if nestedType.Kind() == reflect.Ptr {
+			nestedType = nestedType.Elem()
+		}
+		if tag.columnName == "" && flattenable(nestedType) &&
+			(structField.Anonymous || (tagged && tag.prefix != "")) {
+			nestedFieldPrefix := fieldPrefix
+			if !structField.Anonymous {
+				nestedFieldPrefix += structField.Name + "."
 			}
+			fields = append(fields, collectSchemaFields(nestedType, fieldIndex, nestedFieldPrefix,
+				columnPrefix+tag.prefix, depth+1, visiting)...)
+			continue
 		}
+
+		field := schemaField{
+			fieldName: fieldPrefix + structField.Name,
+			fieldType: structField.Type,
+			index:     fieldIndex,
+			depth:     depth,
+		}
+		if tag.columnName != "" {
+			field.columnName = columnPrefix + tag.columnName
+			field.keyType = tag.keyType
+			field.jsonb = tag.jsonb || defaultJSONB(structField.Type)
+		}
+		fields = append(fields, field)
 	}
 
-	return scm, nil
+	return fields
+}
+
+func copyVisiting(visiting map[reflect.Type]bool) map[reflect.Type]bool {
+	visitingCopy := make(map[reflect.Type]bool, len(visiting)+1)
+	for t := range visiting {
+		visitingCopy[t] = true
+	}
+	return visitingCopy
+}
+
+// dominantSchemaFields applies Go's promotion rules to fields.  Of the fields sharing a name,
+// only the shallowest survives, and if several share the shallowest depth the name is
+// ambiguous and all of them are dropped.  The same rule then resolves fields from different
+// structs that map to the same column.
+func dominantSchemaFields(fields []schemaField) []schemaField {
+	fields = dominantBy(fields, func(field schemaField) string {
+		return field.fieldName
+	})
+	return dominantBy(fields, func(field schemaField) string {
+		return field.columnName
+	})
+}
+
+func dominantBy(fields []schemaField, key func(schemaField) string) []schemaField {
+	minDepth := make(map[string]int)
+	count := make(map[string]int)
+	for _, field := range fields {
+		k := key(field)
+		if depth, ok := minDepth[k]; !ok || field.depth < depth {
+			minDepth[k] = field.depth
+			count[k] = 0
+		}
+		if field.depth == minDepth[k] {
+			count[k]++
+		}
+	}
+
+	var dominant []schemaField
+	for _, field := range fields {
+		k := key(field)
+		if k == "" || (field.depth == minDepth[k] && count[k] == 1) {
+			dominant = append(dominant, field)
+		}
+	}
+	return dominant
+}
+
+// flattenable reports whether fields of struct type t can be flattened into the column set.
+// Structs the driver stores as a single value, such as time.Time and sql.NullString, can't.
+func flattenable(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	if _, ok := nullBaseTypes[t]; ok {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(scannerType) && !t.Implements(valuerType)
+}
+
+// sqlTag is a parsed sql struct tag, e.g. `sql:"id,primarykey,serial"` or
+// `sql:"settings,jsonb"`.  keyType is the key options joined by ":", e.g. primarykey:serial.
+type sqlTag struct {
+	columnName string
+	keyType    string
+	prefix     string
+	jsonb      bool
+}
+
+func parseSQLTag(tagValue string) sqlTag {
+	tokens := strings.Split(tagValue, ",")
+	tag := sqlTag{columnName: tokens[0]}
+
+	var keyTokens []string
+	for _, token := range tokens[1:] {
+		switch {
+		case strings.HasPrefix(token, "prefix="):
+			tag.prefix = strings.TrimPrefix(token, "prefix=")
+		case token == "jsonb":
+			tag.jsonb = true
+		default:
+			keyTokens = append(keyTokens, token)
+		}
+	}
+
+	keyType := strings.Join(keyTokens, ":")
+	switch keyType {
+	case "primarykey":
+		fallthrough
+	case "primarykey:serial":
+		fallthrough
+	case "unique":
+		tag.keyType = keyType
+	}
+
+	return tag
+}
+
+// defaultJSONB reports whether a field of type t is stored as JSONB without a jsonb tag.
+// Maps, interfaces and structs that have no column type of their own are.
+func defaultJSONB(t reflect.Type) bool {
+	baseType, _ := columnBaseType(t)
+	switch baseType.Kind() {
+	case reflect.Map, reflect.Interface:
+		return true
+	case reflect.Struct:
+		return flattenable(baseType)
+	}
+	return false
 }
@@ -2,33 +2,27 @@ package pqutils
 
 import (
 	"context"
-	"database/sql"
-	"errors"
 	"reflect"
 	"strings"
 )
 
-func CountAll(db *sql.DB, table string) (int, error) {
+func CountAll(db Executor, table string) (int, error) {
+	return CountAllContext(context.Background(), db, table)
+}
+
+// CountAllContext is CountAll with a caller supplied context.
+func CountAllContext(ctx context.Context, db Executor, table string) (int, error) {
+	count, err := countAll(ctx, db, table)
+	return count, contextError(ctx, err)
+}
+
+func countAll(ctx context.Context, db Executor, table string) (int, error) {
 	query := `SELECT COUNT(*) 
 		      FROM ` + table
 
 	// Execute the Query
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
-	if err != nil {
-		return 0, err
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-
-	row := conn.QueryRowContext(ctx, query)
-	if err != nil {
-		return 0, err
-	}
-
 	var count int
-	err = row.Scan(&count)
+	err := queryRowStatement(ctx, db, OperationSelect, table, query, &count)
 	if err != nil {
 		return 0, err
 	}
@@ -36,104 +30,100 @@ func CountAll(db *sql.DB, table string) (int, error) {
 	return count, nil
 }
 
-func SelectOne(db *sql.DB, table string, v interface{}) (interface{}, error) {
+// SelectOne returns the record in the specified table identified by the primarykey fields of
+// v.  When no record matches it returns ErrNotFound, and when more than one does, because the
+// key is not actually unique in the table, a MultipleRowsError.  The result is the zero value
+// of the type of v in both cases.
+func SelectOne(db Executor, table string, v interface{}) (interface{}, error) {
+	return SelectOneContext(context.Background(), db, table, v)
+}
+
+// SelectOneContext is SelectOne with a caller supplied context.
+func SelectOneContext(ctx context.Context, db Executor, table string, v interface{}) (interface{}, error) {
 	// Assumption: v is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(v)
 	if err != nil {
 		return nil, err
 	}
-	stm, err := parseStructMetadata(v)
+
+	where, err := primaryKeyWhere(scm, v)
 	if err != nil {
 		return nil, err
 	}
 
-	var where map[string]interface{}
-	for columnName, keyType := range scm.columnKeyTypeMap {
-		if strings.Contains(keyType, "primarykey") {
-			if where == nil {
-				where = make(map[string]interface{})
-			}
-			fieldName := scm.columnNameFieldNameMap[columnName]
-			fieldValue := stm.fieldNameValueMap[fieldName]
-
-			if reflect.Indirect(reflect.ValueOf(v)).FieldByName(fieldName).IsZero() {
-				return nil, errors.New("error: zero value recieved for primary key field: " + fieldName + ". All primary key fields must be non-zero")
-			}
-			where[fieldName] = fieldValue
-		}
-	}
-
-	// Test for uniqueness, if valid should only have one record that matches
-	schemaType := reflect.Indirect(reflect.ValueOf(v)).Type()
-	emptyResult := reflect.New(schemaType).Elem().Interface()
-	results, err := selectAllWithOptions(db, table, v, where, QueryOptions{})
+	// Test for uniqueness, if valid should only have one record that matches.  A second row
+	// is enough to tell, so no more are read.
+	emptyResult := reflect.New(scm.schemaType).Elem().Interface()
+	results, err := selectAllWithOptions(ctx, db, table, v, where, QueryOptions{Limit: 2})
 	if err != nil {
-		return emptyResult, err
+		return emptyResult, contextError(ctx, err)
 	}
-	if len(results) == 0 {
-		return emptyResult, nil
+	switch len(results) {
+	case 0:
+		return emptyResult, ErrNotFound
+	case 1:
+		return results[0], nil
 	}
 
-	return results[0], nil
+	return emptyResult, &MultipleRowsError{Table: table, Type: scm.schemaType}
 }
 
-func SelectAll(db *sql.DB, table string, schema interface{}) ([]interface{}, error) {
-	return selectAllWithOptions(db, table, schema, nil, QueryOptions{})
+func SelectAll(db Executor, table string, schema interface{}) ([]interface{}, error) {
+	return SelectAllContext(context.Background(), db, table, schema)
 }
 
-func SelectAllWithOptions(db *sql.DB, table string, schema interface{}, where map[string]interface{}, options QueryOptions) ([]interface{}, error) {
-	return selectAllWithOptions(db, table, schema, where, options)
+// SelectAllContext is SelectAll with a caller supplied context.
+func SelectAllContext(ctx context.Context, db Executor, table string, schema interface{}) ([]interface{}, error) {
+	results, err := selectAllWithOptions(ctx, db, table, schema, nil, QueryOptions{})
+	return results, contextError(ctx, err)
 }
 
-func selectAllWithOptions(db *sql.DB, table string, schema interface{},
-	where map[string]interface{}, options QueryOptions) ([]interface{}, error) {
+func SelectAllWithOptions(db Executor, table string, schema interface{}, where Filter, options QueryOptions) ([]interface{}, error) {
+	return SelectAllWithOptionsContext(context.Background(), db, table, schema, where, options)
+}
+
+// SelectAllWithOptionsContext is SelectAllWithOptions with a caller supplied context.
+func SelectAllWithOptionsContext(ctx context.Context, db Executor, table string, schema interface{},
+	where Filter, options QueryOptions) ([]interface{}, error) {
+	results, err := selectAllWithOptions(ctx, db, table, schema, where, options)
+	return results, contextError(ctx, err)
+}
+
+func selectAllWithOptions(ctx context.Context, db Executor, table string, schema interface{},
+	where Filter, options QueryOptions) ([]interface{}, error) {
 	// Assumption: schema is a pointer to a struct
 
 	// TODO consider passing a context that allows for the setting of metadata to improve performance
 
+	if options.Cursor != "" {
+		page, err := selectPage(ctx, db, table, schema, where, options)
+		return page.Results, err
+	}
+
 	scm, err := parseSchemaMetadata(schema)
 	if err != nil {
 		return nil, err
 	}
 
-	condition, err := queryConditionString(schema, where, options)
+	stm, err := parseStructMetadata(schema)
 	if err != nil {
 		return nil, err
 	}
-
-	query := `SELECT ` + strings.Join(scm.columnNames, ", ") + `
-		FROM ` + table + ` ` +
-		condition
-
-	// Execute the Query
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
+	columnNames, err := selectColumns(scm, stm, options)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
 
-	rows, err := conn.QueryContext(ctx, query)
+	condition, args, err := queryConditionString(schema, where, options, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = rows.Close()
-	}()
-
-	// Collect the results
-	var results []interface{}
-	for rows.Next() {
-		var rowResult interface{}
-		rowResult, err := unmarshalRowsResult(rows, schema)
-		if err != nil {
-			return nil, err
-		}
-		results = append(results, rowResult)
-	}
 
-	return results, nil
+	query := `SELECT ` + strings.Join(columnNames, ", ") + `
+		FROM ` + table + ` ` +
+		condition
+
+	// Execute the Query
+	return queryStatement(ctx, db, OperationSelect, table, schema, query, args...)
 }
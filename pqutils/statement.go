@@ -0,0 +1,93 @@
+package pqutils
+
+import (
+	"context"
+	"database/sql"
+)
+
+// execStatement runs stmt with db.ExecContext, logs it and reports it to the hooks of db.
+// Constraint violations and serialization failures are returned as typed errors.
+func execStatement(ctx context.Context, db Executor, operation string, table string, stmt string,
+	args ...interface{}) (sql.Result, error) {
+	event := &QueryEvent{Operation: operation, Table: table, SQL: stmt, Args: args}
+	ctx = startStatement(ctx, db, event)
+	result, err := db.ExecContext(ctx, stmt, args...)
+	var rows int64
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+	err = finishStatement(ctx, db, event, rows, err)
+
+	return result, err
+}
+
+// queryStatement runs stmt with db.QueryContext and returns every row as a value of the
+// schema type.  It is logged and reported like execStatement.
+func queryStatement(ctx context.Context, db Executor, operation string, table string, schema interface{},
+	stmt string, args ...interface{}) ([]interface{}, error) {
+	event := &QueryEvent{Operation: operation, Table: table, SQL: stmt, Args: args}
+	ctx = startStatement(ctx, db, event)
+	results, err := queryResults(ctx, db, schema, stmt, args...)
+	err = finishStatement(ctx, db, event, int64(len(results)), err)
+
+	return results, err
+}
+
+func queryResults(ctx context.Context, db Executor, schema interface{}, stmt string, args ...interface{}) ([]interface{}, error) {
+	// Assumption: schema is a pointer to a struct
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	// Collect the results
+	unmarshaler, err := newRowsUnmarshaler(rows, schema)
+	if err != nil {
+		return nil, err
+	}
+	var results []interface{}
+	for rows.Next() {
+		rowResult, err := unmarshaler.unmarshal(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rowResult)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// queryRowStatement runs stmt with db.QueryRowContext and scans the row into dest.  It is
+// logged and reported like execStatement.
+func queryRowStatement(ctx context.Context, db Executor, operation string, table string, stmt string,
+	dest ...interface{}) error {
+	event := &QueryEvent{Operation: operation, Table: table, SQL: stmt}
+	ctx = startStatement(ctx, db, event)
+	err := db.QueryRowContext(ctx, stmt).Scan(dest...)
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	err = finishStatement(ctx, db, event, rows, err)
+
+	return err
+}
+
+// logStatement logs a finished statement to the package Logger.
+func logStatement(ctx context.Context, event *QueryEvent) {
+	logger := currentLogger()
+	if event.Err != nil {
+		logger.WarnContext(ctx, "pqutils: statement failed", "operation", event.Operation, "table", event.Table,
+			"sql", event.SQL, "duration", event.Duration, "error", event.Err)
+		return
+	}
+	logger.DebugContext(ctx, "pqutils: statement", "operation", event.Operation, "table", event.Table,
+		"sql", event.SQL, "duration", event.Duration, "rows", event.Rows)
+}
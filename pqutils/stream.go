@@ -0,0 +1,144 @@
+package pqutils
+
+import (
+	"context"
+	"strconv"
+)
+
+// DefaultBulkInsertChunkSize is the number of rows BulkInsertStream copies in one transaction
+const DefaultBulkInsertChunkSize = 10000
+
+// BulkInsertOptions controls how BulkInsertStream and BulkInsertChannel copy their rows.
+type BulkInsertOptions struct {
+	// ChunkSize is the number of rows copied and committed in each transaction.  Zero means
+	// DefaultBulkInsertChunkSize.
+	ChunkSize int
+
+	// Skip is the number of rows read from the source and discarded before copying starts.
+	// To resume after a failure, read the same source again with Skip set to the Committed
+	// count of the BulkInsertError.
+	Skip int
+
+	// Progress, when set, is called after every committed chunk with the number of rows
+	// committed so far, counting the skipped rows.
+	Progress func(committed int)
+}
+
+// BulkInsertError is returned by BulkInsertStream and BulkInsertChannel when a chunk fails.
+// The chunks before it stay committed, and Committed counts their rows, including any that
+// were skipped.
+type BulkInsertError struct {
+	Committed int
+	Err       error
+}
+
+func (e *BulkInsertError) Error() string {
+	return "bulk insert failed after " + strconv.Itoa(e.Committed) + " committed rows: " + e.Err.Error()
+}
+
+func (e *BulkInsertError) Unwrap() error {
+	return e.Err
+}
+
+// BulkInsertStream copies the rows returned by next into the specified table without holding
+// them all in memory.  next returns the following row and true, or false once the rows are
+// exhausted.  Rows are copied in chunks of options.ChunkSize, each with its own COPY and its
+// own transaction, so a failure only rolls back the chunk it happened in.  The elements may be
+// structs or pointers to structs, as for BulkInsert.  It returns the number of rows committed,
+// counting options.Skip.
+//
+// If db is a *sql.Tx no transaction is committed; each chunk is released from a savepoint
+// instead, as WithTx does.
+func BulkInsertStream[T any](db Executor, table string, next func() (T, bool, error), options BulkInsertOptions) (int, error) {
+	return BulkInsertStreamContext(context.Background(), db, table, next, options)
+}
+
+// BulkInsertStreamContext is BulkInsertStream with a caller supplied context.
+func BulkInsertStreamContext[T any](ctx context.Context, db Executor, table string, next func() (T, bool, error),
+	options BulkInsertOptions) (int, error) {
+	return bulkInsertStream(ctx, db, table, next, options)
+}
+
+// BulkInsertChannel is BulkInsertStream reading its rows from rows until it is closed.
+func BulkInsertChannel[T any](db Executor, table string, rows <-chan T, options BulkInsertOptions) (int, error) {
+	return BulkInsertChannelContext(context.Background(), db, table, rows, options)
+}
+
+// BulkInsertChannelContext is BulkInsertChannel with a caller supplied context.  It stops
+// waiting for rows when ctx is done.
+func BulkInsertChannelContext[T any](ctx context.Context, db Executor, table string, rows <-chan T,
+	options BulkInsertOptions) (int, error) {
+	next := func() (T, bool, error) {
+		select {
+		case row, ok := <-rows:
+			return row, ok, nil
+		case <-ctx.Done():
+			var zero T
+			return zero, false, ctx.Err()
+		}
+	}
+	return bulkInsertStream(ctx, db, table, next, options)
+}
+
+func bulkInsertStream[T any](ctx context.Context, db Executor, table string, next func() (T, bool, error),
+	options BulkInsertOptions) (int, error) {
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultBulkInsertChunkSize
+	}
+
+	committed := 0
+	for committed < options.Skip {
+		_, ok, err := next()
+		if err != nil {
+			return committed, &BulkInsertError{Committed: committed, Err: contextError(ctx, err)}
+		}
+		if !ok {
+			return committed, nil
+		}
+		committed++
+	}
+
+	var scm schemaMetadata
+	var stmtColumns []string
+	chunk := make([]T, 0, chunkSize)
+	for {
+		row, ok, err := next()
+		if err != nil {
+			return committed, &BulkInsertError{Committed: committed, Err: contextError(ctx, err)}
+		}
+		if ok {
+			chunk = append(chunk, row)
+			if len(chunk) < chunkSize {
+				continue
+			}
+		}
+		if len(chunk) == 0 {
+			return committed, nil
+		}
+
+		values := structPointers(chunk)
+		if stmtColumns == nil {
+			scm, err = parseSchemaMetadata(values[0])
+			if err != nil {
+				return committed, &BulkInsertError{Committed: committed, Err: err}
+			}
+			stmtColumns = insertColumns(scm)
+		}
+		err = withTx(ctx, db, nil, func(tx Executor) error {
+			return copyIn(ctx, tx, table, scm, stmtColumns, values)
+		})
+		if err != nil {
+			return committed, &BulkInsertError{Committed: committed, Err: contextError(ctx, err)}
+		}
+
+		committed += len(chunk)
+		if options.Progress != nil {
+			options.Progress(committed)
+		}
+		if !ok {
+			return committed, nil
+		}
+		chunk = chunk[:0]
+	}
+}
@@ -1,17 +1,21 @@
 package pqutils
 
 import (
-	"errors"
 	"reflect"
+	"strings"
+	"sync"
 )
 
 type structMetadata struct {
 	fieldNames           []string
-	fieldNameValueMap    map[string]interface{}
 	jsonNames            []string
 	jsonNameFieldNameMap map[string]string
 }
 
+// structMetadataCache holds the structMetadata already parsed for each struct type.  Like
+// schemaMetadataCache, entries are shared and must be treated as read only.
+var structMetadataCache sync.Map
+
 // parseStructMetadata reutrns a structMetadata object for the passed value v
 //
 // NOTE: If v is passed as a pure interface (i.e. caller receives v as an interface
@@ -20,36 +24,78 @@ type structMetadata struct {
 // a value. More often then not, callers of helper functions will only have a intervace for
 // v.  For this reason, we call checkStructPtr() and return an error if v is not a pointer
 // to a struct.
+//
+// Field values are not part of the metadata, since it is cached per type.  Read them through
+// the field indexes in schemaMetadata instead.
 func parseStructMetadata(v interface{}) (structMetadata, error) {
 	// Check that v is a pointer to a struct
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return structMetadata{}, errors.New("invalid type: must be a non-nil pointer to a struct: " + reflect.TypeOf(v).String())
+		return structMetadata{}, &InvalidTypeError{RequiredType: "StructPtr", InvalidType: reflect.TypeOf(v)}
 	}
 	if reflect.Indirect(rv).Kind() != reflect.Struct {
-		return structMetadata{}, errors.New("invalid type: must be a non-nil pointer to a struct: " + reflect.TypeOf(v).String())
+		return structMetadata{}, &InvalidTypeError{RequiredType: "StructPtr", InvalidType: reflect.TypeOf(v)}
+	}
+
+	structType := rv.Elem().Type()
+	if cached, ok := structMetadataCache.Load(structType); ok {
+		return cached.(structMetadata), nil
 	}
 
-	rve := rv.Elem()
 	var sm structMetadata
-	for i := 0; i < rve.NumField(); i++ {
-		structField := rve.Type().Field(i)
-		fieldName := structField.Name
+	collectStructFields(&sm, structType)
+	structMetadataCache.Store(structType, sm)
 
-		if sm.fieldNameValueMap == nil {
-			sm.fieldNameValueMap = make(map[string]interface{})
-		}
-		sm.fieldNames = append(sm.fieldNames, fieldName)
-		sm.fieldNameValueMap[fieldName] = rve.Field(i).Interface()
+	return sm, nil
+}
 
-		if jsonName := structField.Tag.Get("json"); jsonName != "" {
-			if sm.jsonNameFieldNameMap == nil {
-				sm.jsonNameFieldNameMap = make(map[string]string)
+// collectStructFields adds the fields of t to sm.  Like encoding/json, the fields of embedded
+// structs without a json tag are promoted into t.  Structs are walked breadth first, so when
+// two fields share a json name the shallower one keeps it.
+func collectStructFields(sm *structMetadata, t reflect.Type) {
+	visited := map[reflect.Type]bool{}
+	level := []reflect.Type{t}
+	for len(level) > 0 {
+		var next []reflect.Type
+		for _, structType := range level {
+			if visited[structType] {
+				continue
+			}
+			visited[structType] = true
+
+			for i := 0; i < structType.NumField(); i++ {
+				structField := structType.Field(i)
+				fieldName := structField.Name
+				// Only the name part of the json tag is used, and "-" means the field has none
+				jsonTag := structField.Tag.Get("json")
+				jsonName := strings.Split(jsonTag, ",")[0]
+				if jsonTag == "-" {
+					jsonName = ""
+				}
+
+				embeddedType := structField.Type
+				if embeddedType.Kind() == reflect.Ptr {
+					embeddedType = embeddedType.Elem()
+				}
+				if structField.Anonymous && jsonName == "" && jsonTag != "-" && embeddedType.Kind() == reflect.Struct {
+					next = append(next, embeddedType)
+					continue
+				}
+
+				sm.fieldNames = append(sm.fieldNames, fieldName)
+
+				if jsonName != "" {
+					if sm.jsonNameFieldNameMap == nil {
+						sm.jsonNameFieldNameMap = make(map[string]string)
+					}
+					if _, ok := sm.jsonNameFieldNameMap[jsonName]; ok {
+						continue
+					}
+					sm.jsonNames = append(sm.jsonNames, jsonName)
+					sm.jsonNameFieldNameMap[jsonName] = fieldName
+				}
 			}
-			sm.jsonNames = append(sm.jsonNames, jsonName)
-			sm.jsonNameFieldNameMap[jsonName] = fieldName
 		}
+		level = next
 	}
-
-	return sm, nil
 }
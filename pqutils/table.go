@@ -2,13 +2,20 @@ package pqutils
 
 import (
 	"context"
-	"database/sql"
 	"reflect"
 	"strings"
-	"time"
 )
 
-func CreateTableFromType(db *sql.DB, table string, schema interface{}) error {
+func CreateTableFromType(db Executor, table string, schema interface{}) error {
+	return CreateTableFromTypeContext(context.Background(), db, table, schema)
+}
+
+// CreateTableFromTypeContext is CreateTableFromType with a caller supplied context.
+func CreateTableFromTypeContext(ctx context.Context, db Executor, table string, schema interface{}) error {
+	return contextError(ctx, createTableFromType(ctx, db, table, schema))
+}
+
+func createTableFromType(ctx context.Context, db Executor, table string, schema interface{}) error {
 	// Assumption: schema is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(schema)
@@ -48,19 +55,36 @@ func CreateTableFromType(db *sql.DB, table string, schema interface{}) error {
 		}
 	*/
 
+	// A single primary key column is declared inline.  Composite keys get NOT NULL columns and a
+	// table constraint listing the key columns in field order.
+	primaryKey := " PRIMARY KEY NOT NULL"
+	if len(scm.primaryKeyColumns) > 1 {
+		primaryKey = " NOT NULL"
+	}
+
 	// Build column  definitions
 	var columnDefinitions []string
 	for _, columnName := range scm.columnNames {
 		var columnDefinition string
-		fieldType := scm.columnNameFieldKindMap[columnName]
-		switch fieldType {
+		fieldType, nullable := columnBaseType(scm.columnNameFieldTypeMap[columnName])
+		if scm.columnJSONBMap[columnName] {
+			// JSONB columns hold structs, maps and interfaces, which have no sensible default
+			columnDefinitions = append(columnDefinitions, columnName+" JSONB")
+			continue
+		}
+		switch fieldType.Kind() {
 		case reflect.Bool:
 			// Booleans are likely not key values so skip keyColumns switch
-			columnDefinition = columnName + " BOOLEAN DEFAULT FALSE"
+			columnDefinition = columnName + " BOOLEAN" + columnDefault(nullable, "FALSE")
+
+		case reflect.Float32:
+			columnDefinition = columnName + " REAL" + columnDefault(nullable, "0")
 
 		case reflect.Float64:
-			//not sure what to do here
-			break
+			columnDefinition = columnName + " DOUBLE PRECISION" + columnDefault(nullable, "0")
+
+		case reflect.Int8, reflect.Int16, reflect.Uint8:
+			columnDefinition = columnName + " SMALLINT" + columnDefault(nullable, "0")
 
 		case reflect.Int:
 			fallthrough
@@ -68,58 +92,68 @@ func CreateTableFromType(db *sql.DB, table string, schema interface{}) error {
 		case reflect.Int32:
 			switch scm.columnKeyTypeMap[columnName] {
 			case "primarykey":
-				columnDefinition = columnName + " INTEGER PRIMARY KEY NOT NULL"
+				columnDefinition = columnName + " INTEGER" + primaryKey
 			case "primarykey:serial":
-				columnDefinition = columnName + " SERIAL PRIMARY KEY NOT NULL"
+				columnDefinition = columnName + " SERIAL" + primaryKey
 			case "unique":
-				columnDefinition = columnName + " INTEGER UNIQUE NOT NULL"
+				columnDefinition = columnName + " INTEGER UNIQUE" + columnNotNull(nullable)
 			default:
-				columnDefinition = columnName + " INTEGER DEFAULT 0"
+				columnDefinition = columnName + " INTEGER" + columnDefault(nullable, "0")
 			}
 
 		case reflect.Int64:
 			switch scm.columnKeyTypeMap[columnName] {
 			case "primarykey":
-				columnDefinition = columnName + " BIGINT PRIMARY KEY NOT NULL"
+				columnDefinition = columnName + " BIGINT" + primaryKey
 			case "primarykey:serial":
-				columnDefinition = columnName + " SERIAL PRIMARY KEY NOT NULL"
+				columnDefinition = columnName + " SERIAL" + primaryKey
 			case "unique":
-				columnDefinition = columnName + " BIGINT UNIQUE not null"
+				columnDefinition = columnName + " BIGINT UNIQUE" + columnNotNull(nullable)
 			default:
-				columnDefinition = columnName + " BIGINT DEFAULT 0"
+				columnDefinition = columnName + " BIGINT" + columnDefault(nullable, "0")
 			}
 
 		case reflect.String:
 			switch scm.columnKeyTypeMap[columnName] {
 			case "primarykey":
-				columnDefinition = columnName + " VARCHAR PRIMARY KEY NOT NULL"
+				columnDefinition = columnName + " VARCHAR" + primaryKey
 			case "primarykey:serial":
 				// Not a valid case for String types
 				break
 			case "unique":
-				columnDefinition = columnName + " VARCHAR UNIQUE not null"
+				columnDefinition = columnName + " VARCHAR UNIQUE" + columnNotNull(nullable)
 			default:
-				columnDefinition = columnName + " VARCHAR DEFAULT ''"
+				columnDefinition = columnName + " VARCHAR" + columnDefault(nullable, "''")
 			}
 
-		case reflect.TypeOf(time.Time{}).Kind():
+		case reflect.Struct:
+			if fieldType != timeType {
+				break
+			}
 			switch scm.columnKeyTypeMap[columnName] {
 			case "primarykey":
-				columnDefinition = columnName + " TIMESTAMPTZ PRIMARY KEY NOT NULL"
+				columnDefinition = columnName + " TIMESTAMPTZ" + primaryKey
 			case "primarykey:serial":
 				// Not a valid case for time.Time types
 				break
 			case "unique":
-				columnDefinition = columnName + " TIMESTAMPTZ UNIQUE NOT NULL"
+				columnDefinition = columnName + " TIMESTAMPTZ UNIQUE" + columnNotNull(nullable)
 			default:
-				columnDefinition = columnName + " TIMESTAMPTZ  DEFAULT '0001-01-01T00:00:00Z'"
+				columnDefinition = columnName + " TIMESTAMPTZ" + columnDefault(nullable, "'0001-01-01T00:00:00Z'")
 			}
 
 		case reflect.Slice:
 			// Slices are likely not key values so skip keyColumns switch
-			// TODO figure out slice type first then build case statement
-			//  but for now just make a VARCHAR[]
-			columnDefinition = columnName + " VARCHAR[] DEFAULT '{}'"
+			elemType := fieldType.Elem()
+			if elemType.Kind() == reflect.Uint8 {
+				columnDefinition = columnName + " BYTEA" + columnDefault(nullable, "''")
+				break
+			}
+			arrayType, ok := arrayColumnTypes[elemType]
+			if !ok {
+				arrayType = "VARCHAR[]"
+			}
+			columnDefinition = columnName + " " + arrayType + columnDefault(nullable, "'{}'")
 		}
 
 		if columnDefinition != "" {
@@ -127,43 +161,54 @@ func CreateTableFromType(db *sql.DB, table string, schema interface{}) error {
 		}
 	}
 
+	if len(scm.primaryKeyColumns) > 1 {
+		columnDefinitions = append(columnDefinitions, "PRIMARY KEY ("+strings.Join(scm.primaryKeyColumns, ", ")+")")
+	}
+
 	// Build create statement
 	createStatement := "CREATE TABLE " + table + "( " +
 		strings.Join(columnDefinitions, ", ") +
 		");"
 
 	// Execute the create statement
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
+	_, err = execStatement(ctx, db, OperationDDL, table, createStatement)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
 
-	_, err = conn.ExecContext(ctx, createStatement)
-	if err != nil {
-		return err
+	return nil
+}
+
+// columnDefault returns the DEFAULT clause for a column.  Nullable columns have no default so
+// that omitted values are stored as NULL.
+func columnDefault(nullable bool, defaultValue string) string {
+	if nullable {
+		return ""
 	}
+	return " DEFAULT " + defaultValue
+}
 
-	return nil
+func columnNotNull(nullable bool) string {
+	if nullable {
+		return ""
+	}
+	return " NOT NULL"
+}
+
+func DropTable(db Executor, table string) error {
+	return DropTableContext(context.Background(), db, table)
 }
 
-func DropTable(db *sql.DB, table string) error {
+// DropTableContext is DropTable with a caller supplied context.
+func DropTableContext(ctx context.Context, db Executor, table string) error {
+	return contextError(ctx, dropTable(ctx, db, table))
+}
+
+func dropTable(ctx context.Context, db Executor, table string) error {
 	stmt := `DROP TABLE ` + table
 
 	// Execute the Statement
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-
-	_, err = conn.ExecContext(ctx, stmt)
+	_, err := execStatement(ctx, db, OperationDDL, table, stmt)
 	if err != nil {
 		return err
 	}
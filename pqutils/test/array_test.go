@@ -0,0 +1,82 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testArrayType struct {
+	Id      int         `json:"id" sql:"id,primarykey,serial"`
+	Counts  []int64     `json:"counts" sql:"counts"`
+	Ranks   []int32     `json:"ranks" sql:"ranks"`
+	Scores  []float64   `json:"scores" sql:"scores"`
+	Flags   []bool      `json:"flags" sql:"flags"`
+	Tags    []string    `json:"tags" sql:"tags"`
+	Visited []time.Time `json:"visited" sql:"visited"`
+}
+
+func TestArrayRoundTrip(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_array_table", &testArrayType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_array_table")
+	}()
+
+	want := testArrayType{
+		Counts:  []int64{1, 2, 3},
+		Ranks:   []int32{4, 5},
+		Scores:  []float64{1.5, 2.25},
+		Flags:   []bool{true, false},
+		Tags:    []string{"a,b", `quote"d`, "O'Brien"},
+		Visited: []time.Time{time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)},
+	}
+	inserted, err := pqutils.Insert(db, "test_array_table", want)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	inserted.Tags = append(inserted.Tags, "updated")
+	_, err = pqutils.UpdateOne(db, "test_array_table", &inserted)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	got, err := pqutils.Get(db, "test_array_table", testArrayType{Id: inserted.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(got.Counts, want.Counts) || !reflect.DeepEqual(got.Ranks, want.Ranks) ||
+		!reflect.DeepEqual(got.Scores, want.Scores) || !reflect.DeepEqual(got.Flags, want.Flags) ||
+		!reflect.DeepEqual(got.Tags, inserted.Tags) || len(got.Visited) != 1 || !got.Visited[0].Equal(want.Visited[0]) {
+		log.Println("expected:", inserted, "Received:", got)
+		t.FailNow()
+	}
+
+	err = pqutils.BulkInsert(db, "test_array_table", []testArrayType{want, want})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testHookKey struct{}
+
+// testHook records the events it sees, and checks the context of AfterQuery is the one its
+// BeforeQuery returned
+type testHook struct {
+	events []pqutils.QueryEvent
+	failed bool
+}
+
+func (h *testHook) BeforeQuery(ctx context.Context, event *pqutils.QueryEvent) context.Context {
+	return context.WithValue(ctx, testHookKey{}, event.SQL)
+}
+
+func (h *testHook) AfterQuery(ctx context.Context, event *pqutils.QueryEvent) {
+	if ctx.Value(testHookKey{}) != event.SQL {
+		h.failed = true
+	}
+	h.events = append(h.events, *event)
+}
+
+func TestClientHooks(t *testing.T) {
+	// Nothing listens at this address, so the statement fails
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	hook := &testHook{}
+	client := pqutils.NewClient(db, hook)
+	_, err = pqutils.CountAll(client, "test_table")
+	if err == nil {
+		log.Println("expected: an error without a database")
+		t.FailNow()
+	}
+
+	if len(hook.events) != 1 || hook.failed {
+		log.Println("expected: one event with the BeforeQuery context. Received:", hook.events)
+		t.FailNow()
+	}
+	event := hook.events[0]
+	if event.Operation != pqutils.OperationSelect || event.Table != "test_table" || event.SQL == "" ||
+		event.Err == nil || event.Duration <= 0 {
+		log.Println("expected: a failed select event for test_table. Received:", event)
+		t.FailNow()
+	}
+}
+
+func TestClientWithTx(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	hook := &testHook{}
+	client := pqutils.NewClient(db, hook)
+	var inserted testType
+	err = client.WithTx(context.Background(), nil, func(tx *pqutils.Client) error {
+		inserted, err = pqutils.Insert(tx, "test_table", testType{FirstName: "Hook", LastName: "Test"})
+		if err != nil {
+			return err
+		}
+		return tx.WithTx(context.Background(), nil, func(tx *pqutils.Client) error {
+			_, err = pqutils.DeleteOne(tx, "test_table", &inserted)
+			return err
+		})
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	// The transaction and savepoint statements are reported as well as the statements in them
+	expected := []string{pqutils.OperationTx, pqutils.OperationInsert, pqutils.OperationTx,
+		pqutils.OperationDelete, pqutils.OperationTx, pqutils.OperationTx}
+	var operations []string
+	for _, event := range hook.events {
+		operations = append(operations, event.Operation)
+	}
+	if !reflect.DeepEqual(operations, expected) || hook.events[0].SQL != "BEGIN" ||
+		!strings.HasPrefix(hook.events[2].SQL, "SAVEPOINT") || hook.events[3].Rows != 1 ||
+		!strings.HasPrefix(hook.events[4].SQL, "RELEASE SAVEPOINT") || hook.events[5].SQL != "COMMIT" {
+		log.Println("expected: BEGIN, insert, SAVEPOINT, delete, RELEASE and COMMIT events. Received:", hook.events)
+		t.FailNow()
+	}
+}
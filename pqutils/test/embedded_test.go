@@ -0,0 +1,101 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type Timestamps struct {
+	CreatedAt time.Time `json:"createdAt" sql:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" sql:"updated_at"`
+}
+
+type AuditFields struct {
+	CreatedBy string `json:"createdBy" sql:"created_by"`
+}
+
+type Address struct {
+	Street string `json:"street" sql:"street"`
+	City   string `json:"city" sql:"city"`
+}
+
+type testEmbeddedType struct {
+	Id int `json:"id" sql:"id,primarykey,serial"`
+	Timestamps
+	*AuditFields
+	Home Address `json:"home" sql:",prefix=home_"`
+	Name string  `json:"name" sql:"name"`
+}
+
+func TestEmbeddedSchemaColumnNames(t *testing.T) {
+	columnNames, err := pqutils.SchemaColumnNames(&testEmbeddedType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	sort.Strings(columnNames)
+
+	want := []string{"created_at", "created_by", "home_city", "home_street", "id", "name", "updated_at"}
+	if !reflect.DeepEqual(columnNames, want) {
+		log.Println("expected:", want, "Received:", columnNames)
+		t.FailNow()
+	}
+}
+
+func TestEmbeddedRoundTrip(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_embedded_table", &testEmbeddedType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_embedded_table")
+	}()
+
+	want := testEmbeddedType{
+		Timestamps:  Timestamps{CreatedAt: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)},
+		AuditFields: &AuditFields{CreatedBy: "admin"},
+		Home:        Address{Street: "1 Main St", City: "Springfield"},
+		Name:        "Embedded",
+	}
+	inserted, err := pqutils.Insert(db, "test_embedded_table", want)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	inserted.Home.City = "Shelbyville"
+	_, err = pqutils.UpdateOne(db, "test_embedded_table", &inserted)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	got, err := pqutils.Get(db, "test_embedded_table", testEmbeddedType{Id: inserted.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.AuditFields == nil || got.CreatedBy != "admin" ||
+		got.Home != inserted.Home || got.Name != want.Name {
+		log.Println("expected:", inserted, "Received:", got)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestUniqueViolationError(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_error_table", &testUpsertType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_error_table")
+	}()
+
+	_, err = pqutils.InsertOne(db, "test_error_table", &testUpsertType{Email: "a@example.com"})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	_, err = pqutils.InsertOne(db, "test_error_table", &testUpsertType{Email: "a@example.com"})
+
+	var uniqueViolationError *pqutils.UniqueViolationError
+	if !errors.As(err, &uniqueViolationError) {
+		log.Println("expected: UniqueViolationError. Received:", err)
+		t.FailNow()
+	}
+	if uniqueViolationError.Operation != pqutils.OperationInsert || uniqueViolationError.Table != "test_error_table" ||
+		!reflect.DeepEqual(uniqueViolationError.Columns, []string{"email"}) {
+		log.Println("expected: an insert into test_error_table violating email. Received:", uniqueViolationError)
+		t.FailNow()
+	}
+
+	// The driver error is still available
+	var pqError *pq.Error
+	if !errors.As(err, &pqError) {
+		log.Println("expected: the error to wrap a *pq.Error. Received:", err)
+		t.FailNow()
+	}
+}
+
+func TestInvalidTypeError(t *testing.T) {
+	// The type is checked before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	for _, schema := range []interface{}{testType{}, nil, (*testType)(nil), &[]testType{}} {
+		_, err = pqutils.SelectAll(db, "test_table", schema)
+		var invalidTypeError *pqutils.InvalidTypeError
+		if !errors.As(err, &invalidTypeError) || invalidTypeError.Error() == "" {
+			log.Println("expected: InvalidTypeError for", reflect.TypeOf(schema), "Received:", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestInvalidTypeErrorNilElement(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	values := []interface{}{&testType{FirstName: "Nil", LastName: "Element"}, nil}
+	results, errs := pqutils.InsertAll(tx, "test_table", values)
+	var rowError *pqutils.RowError
+	var invalidTypeError *pqutils.InvalidTypeError
+	if len(errs) != 1 || !errors.As(errs[0], &rowError) || rowError.Index != 1 ||
+		!errors.As(errs[0], &invalidTypeError) || invalidTypeError.InvalidType != nil {
+		log.Println("expected: a single RowError with an InvalidTypeError for row 1. Received:", errs)
+		t.FailNow()
+	}
+	if results[0] == nil || results[1] != nil {
+		log.Println("expected: a result for row 0 only. Received:", results)
+		t.FailNow()
+	}
+
+	// A leading nil doesn't decide the type, so only it fails
+	results, errs = pqutils.InsertAll(tx, "test_table", []interface{}{nil, &testType{FirstName: "Leading", LastName: "Nil"}})
+	if len(errs) != 1 || !errors.As(errs[0], &rowError) || rowError.Index != 0 ||
+		!errors.As(errs[0], &invalidTypeError) || invalidTypeError.InvalidType != nil {
+		log.Println("expected: a single RowError with an InvalidTypeError for row 0. Received:", errs)
+		t.FailNow()
+	}
+	if results[0] != nil || results[1] == nil || results[1].(testType).FirstName != "Leading" {
+		log.Println("expected: a result for row 1 only. Received:", results)
+		t.FailNow()
+	}
+
+	err = pqutils.BulkInsert(tx, "test_table", values)
+	if !errors.As(err, &invalidTypeError) || invalidTypeError.InvalidType != nil {
+		log.Println("expected: InvalidTypeError for the nil element. Received:", err)
+		t.FailNow()
+	}
+}
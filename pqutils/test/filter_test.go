@@ -0,0 +1,148 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestSelectWithFilter(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	results, err := pqutils.Select[testType](db, "test_table",
+		pqutils.And(
+			pqutils.Or(pqutils.ILike("LastName", "sm%"), pqutils.In("json:firstName", []string{"Jack", "John"})),
+			pqutils.Between("Id", 1, 1000),
+			pqutils.Ne("MiddleName", nil),
+		), pqutils.QueryOptions{OrderBy: []string{"Id"}})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	for _, result := range results {
+		if !strings.HasPrefix(strings.ToLower(result.LastName), "sm") &&
+			result.FirstName != "Jack" && result.FirstName != "John" {
+			log.Println("expected: only records matching the filter. Received:", result)
+			t.FailNow()
+		}
+		if result.Id < 1 || result.Id > 1000 {
+			log.Println("expected: only records with Id between 1 and 1000. Received:", result.Id)
+			t.FailNow()
+		}
+	}
+
+	log.Println(results)
+}
+
+func TestSelectWithEmptyStringFilter(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	// Empty strings are ordinary values and are not skipped
+	results, err := pqutils.Select[testType](db, "test_table", pqutils.Where{"MiddleName": ""}, pqutils.QueryOptions{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	for _, result := range results {
+		if result.MiddleName != "" {
+			log.Println("expected: only records with an empty MiddleName. Received:", result.MiddleName)
+			t.FailNow()
+		}
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	// Filters are validated before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.SelectAllWithOptions(db, "test_table", &testType{}, pqutils.Gt("Age", 30), pqutils.QueryOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid fieldName") {
+		log.Println("expected: invalid fieldName error. Received:", err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.UpdateAllWithOptions(db, "test_table", &testType{}, nil, pqutils.Or(pqutils.Where{}, pqutils.Eq("Id", 1)))
+	if err == nil || !strings.Contains(err.Error(), "UnsafeUpdateAll") {
+		log.Println("expected: an error refusing to update every record. Received:", err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.DeleteAllWithOptions(db, "test_table", &testType{}, pqutils.And())
+	if err == nil || !strings.Contains(err.Error(), "UnsafeDeleteAll") {
+		log.Println("expected: an error refusing to delete every record. Received:", err)
+		t.FailNow()
+	}
+
+	var ids []int
+	for _, where := range []pqutils.Filter{pqutils.NotIn("Id"), pqutils.NotIn("Id", ids),
+		pqutils.And(pqutils.NotIn("Id"), pqutils.Where{})} {
+		_, err = pqutils.DeleteAllWithOptions(db, "test_table", &testType{}, where)
+		if err == nil || !strings.Contains(err.Error(), "UnsafeDeleteAll") {
+			log.Println("expected: an error refusing to delete every record with an empty NotIn. Received:", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestFilterNullPointer(t *testing.T) {
+	// The statement is recorded by the hook before it fails, so no database is needed
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	hook := &testHook{}
+	client := pqutils.NewClient(db, hook)
+	var nickname *string
+	filters := []pqutils.Filter{pqutils.Where{"Nickname": nickname}, pqutils.Eq("Nickname", nickname),
+		pqutils.Ne("Email", sql.NullString{})}
+	for _, where := range filters {
+		_, _ = pqutils.SelectAllWithOptions(client, "test_null_table", &testNullType{}, where, pqutils.QueryOptions{})
+	}
+
+	expected := []string{"WHERE nickname IS NULL", "WHERE nickname IS NULL", "WHERE email IS NOT NULL"}
+	if len(hook.events) != len(expected) {
+		log.Println("expected: a select for each filter. Received:", hook.events)
+		t.FailNow()
+	}
+	for i, event := range hook.events {
+		if !strings.Contains(event.SQL, expected[i]) || len(event.Args) != 0 {
+			log.Println("expected:", expected[i], "without arguments. Received:", event.SQL, event.Args)
+			t.FailNow()
+		}
+	}
+
+	_, err = pqutils.SelectAllWithOptions(client, "test_null_table", &testNullType{},
+		pqutils.Between("Nickname", nickname, "z"), pqutils.QueryOptions{})
+	if err == nil || !strings.Contains(err.Error(), "nil bound") {
+		log.Println("expected: an error for a nil Between bound. Received:", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"testing"
+)
+
+func TestInsertGeneric(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	result, err := pqutils.Insert(db, "test_table", testType{
+		FirstName:  "Gene",
+		MiddleName: "R",
+		LastName:   "Ric",
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if result.Id == 0 {
+		log.Println("expected: serial id to be returned for inserted record")
+		t.FailNow()
+	}
+
+	log.Println(&result)
+}
+
+func TestGetGeneric(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	result, err := pqutils.Get(db, "test_table", testType{Id: 2})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if result.Id != 2 {
+		log.Println("expected: record with id 2. Received:", result.Id)
+		t.FailNow()
+	}
+
+	log.Println(&result)
+}
+
+func TestSelectGeneric(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	results, err := pqutils.Select[testType](db, "test_table", pqutils.Where{"LastName": "Smith"},
+		pqutils.QueryOptions{OrderBy: []string{"Id"}})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	for _, result := range results {
+		if result.LastName != "Smith" {
+			log.Println("expected: only records with LastName Smith. Received:", result.LastName)
+			t.FailNow()
+		}
+	}
+
+	log.Println(results)
+}
+
+func TestBulkInsertGeneric(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.BulkInsert(db, "test_table", []testType{
+		{FirstName: "Bulk", LastName: "One"},
+		{FirstName: "Bulk", LastName: "Two"},
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+}
+
+func TestFindAndMultipleRows(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	// Without a primary key constraint the table can hold duplicate keys
+	_, err = db.Exec(`CREATE TABLE test_multiple_table (id INTEGER, first_name VARCHAR, middle_name VARCHAR, last_name VARCHAR);
+		INSERT INTO test_multiple_table VALUES (1, 'A', '', 'B'), (2, 'C', '', 'D'), (2, 'E', '', 'F')`)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_multiple_table")
+	}()
+
+	result, found, err := pqutils.Find(db, "test_multiple_table", testType{Id: 1})
+	if err != nil || !found || result.FirstName != "A" {
+		log.Println("expected: record 1 to be found. Received:", result, found, err)
+		t.FailNow()
+	}
+
+	_, found, err = pqutils.Find(db, "test_multiple_table", testType{Id: 3})
+	if err != nil || found {
+		log.Println("expected: record 3 not to be found without an error. Received:", found, err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.Get(db, "test_multiple_table", testType{Id: 3})
+	if !errors.Is(err, pqutils.ErrNotFound) {
+		log.Println("expected: ErrNotFound. Received:", err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.Get(db, "test_multiple_table", testType{Id: 2})
+	var multipleRowsError *pqutils.MultipleRowsError
+	if !errors.As(err, &multipleRowsError) || multipleRowsError.Table != "test_multiple_table" {
+		log.Println("expected: MultipleRowsError. Received:", err)
+		t.FailNow()
+	}
+}
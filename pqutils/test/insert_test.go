@@ -2,11 +2,17 @@ package test
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/tnyidea/sqlutils/pqutils"
 	"log"
+	"strconv"
 	"testing"
 )
 
+type testSerialOnlyType struct {
+	Id int `json:"id" sql:"id,primarykey,serial"`
+}
+
 func TestInsertOne(t *testing.T) {
 	config, err := configureTest()
 	if err != nil {
@@ -32,3 +38,129 @@ func TestInsertOne(t *testing.T) {
 
 	log.Println(result)
 }
+
+func TestInsertOneInTransaction(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result, err := pqutils.InsertOne(tx, "test_table", &testType{
+		FirstName:  "Tina",
+		MiddleName: "T",
+		LastName:   "Transaction",
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	inserted := result.(testType)
+	_, err = pqutils.DeleteOne(tx, "test_table", &inserted)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	log.Println(result)
+}
+
+func TestInsertAllWithOptions(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var values []interface{}
+	for i := 0; i < 5; i++ {
+		values = append(values, &testType{FirstName: "Batch" + strconv.Itoa(i), LastName: "Insert"})
+	}
+	values[3] = &testUpsertType{}
+
+	results, errs := pqutils.InsertAllWithOptions(tx, "test_table", values, pqutils.InsertOptions{BatchSize: 2})
+	var rowError *pqutils.RowError
+	if len(errs) != 1 || !errors.As(errs[0], &rowError) || rowError.Index != 3 {
+		log.Println("expected: a single RowError for row 3. Received:", errs)
+		t.FailNow()
+	}
+	for i, result := range results {
+		if i == 3 {
+			if result != nil {
+				log.Println("expected: no result for row 3. Received:", result)
+				t.FailNow()
+			}
+			continue
+		}
+		inserted := result.(testType)
+		if inserted.Id == 0 || inserted.FirstName != "Batch"+strconv.Itoa(i) {
+			log.Println("expected: the results in input order. Received:", inserted)
+			t.FailNow()
+		}
+	}
+}
+
+func TestInsertSerialOnly(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_serial_table", &testSerialOnlyType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_serial_table")
+	}()
+
+	_, err = pqutils.InsertOne(db, "test_serial_table", &testSerialOnlyType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	results, errs := pqutils.InsertAll(db, "test_serial_table", []interface{}{&testSerialOnlyType{}, &testSerialOnlyType{}})
+	if errs != nil || len(results) != 2 {
+		log.Println("expected: 2 rows inserted. Received:", results, errs)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"testing"
+)
+
+type testSettings struct {
+	Theme         string `json:"theme"`
+	Notifications bool   `json:"notifications"`
+}
+
+type testJSONBType struct {
+	Id       int                    `json:"id" sql:"id,primarykey,serial"`
+	Settings testSettings           `json:"settings" sql:"settings"`
+	Labels   map[string]string      `json:"labels" sql:"labels"`
+	Extra    interface{}            `json:"extra" sql:"extra"`
+	History  []testSettings         `json:"history" sql:"history,jsonb"`
+	Optional map[string]interface{} `json:"optional" sql:"optional"`
+}
+
+func TestJSONBRoundTrip(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_jsonb_table", &testJSONBType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_jsonb_table")
+	}()
+
+	want := testJSONBType{
+		Settings: testSettings{Theme: "dark", Notifications: true},
+		Labels:   map[string]string{"team": "core"},
+		Extra:    "anything",
+		History:  []testSettings{{Theme: "light"}},
+	}
+	inserted, err := pqutils.Insert(db, "test_jsonb_table", want)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	inserted.Settings.Theme = "solarized"
+	_, err = pqutils.UpdateOne(db, "test_jsonb_table", &inserted)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	got, err := pqutils.Get(db, "test_jsonb_table", testJSONBType{Id: inserted.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if got.Settings != inserted.Settings || !reflect.DeepEqual(got.Labels, want.Labels) ||
+		got.Extra != want.Extra || !reflect.DeepEqual(got.History, want.History) || got.Optional != nil {
+		log.Println("expected:", inserted, "Received:", got)
+		t.FailNow()
+	}
+}
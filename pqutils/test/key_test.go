@@ -0,0 +1,89 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"testing"
+)
+
+type testCompositeKeyType struct {
+	TenantId int64  `json:"tenantId" sql:"tenant_id,primarykey"`
+	UserId   int64  `json:"userId" sql:"user_id,primarykey"`
+	Role     string `json:"role" sql:"role"`
+}
+
+func TestCompositeKeyPartiallyZero(t *testing.T) {
+	// The key is validated before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.DeleteOne(db, "test_composite_table", &testCompositeKeyType{TenantId: 1})
+	var keyError *pqutils.KeyError
+	if !errors.As(err, &keyError) || !reflect.DeepEqual(keyError.ZeroFields, []string{"UserId"}) {
+		log.Println("expected: KeyError for zero UserId. Received:", err)
+		t.FailNow()
+	}
+}
+
+func TestCompositeKeyRoundTrip(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_composite_table", &testCompositeKeyType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_composite_table")
+	}()
+
+	for _, v := range []testCompositeKeyType{{1, 1, "owner"}, {1, 2, "member"}, {2, 1, "owner"}} {
+		_, err = pqutils.Insert(db, "test_composite_table", v)
+		if err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+	}
+
+	_, err = pqutils.UpdateOne(db, "test_composite_table", &testCompositeKeyType{TenantId: 1, UserId: 2, Role: "admin"})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	got, err := pqutils.Get(db, "test_composite_table", testCompositeKeyType{TenantId: 1, UserId: 2})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if got.Role != "admin" {
+		log.Println("expected: role admin for (1, 2). Received:", got)
+		t.FailNow()
+	}
+
+	result, err := pqutils.DeleteOne(db, "test_composite_table", &testCompositeKeyType{TenantId: 2, UserId: 1})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected != 1 {
+		log.Println("expected: exactly one row deleted. Received:", rowsAffected)
+		t.FailNow()
+	}
+}
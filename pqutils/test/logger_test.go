@@ -0,0 +1,77 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLogRecord is one call of testLogger
+type testLogRecord struct {
+	level string
+	msg   string
+	args  []any
+}
+
+// testLogger records its calls.  It implements pqutils.Logger the way *slog.Logger does.
+type testLogger struct {
+	mu      sync.Mutex
+	records []testLogRecord
+}
+
+func (l *testLogger) record(level string, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, testLogRecord{level: level, msg: msg, args: args})
+}
+
+func (l *testLogger) DebugContext(_ context.Context, msg string, args ...any) {
+	l.record("debug", msg, args)
+}
+func (l *testLogger) InfoContext(_ context.Context, msg string, args ...any) {
+	l.record("info", msg, args)
+}
+func (l *testLogger) WarnContext(_ context.Context, msg string, args ...any) {
+	l.record("warn", msg, args)
+}
+func (l *testLogger) ErrorContext(_ context.Context, msg string, args ...any) {
+	l.record("error", msg, args)
+}
+
+func TestSetLogger(t *testing.T) {
+	logger := &testLogger{}
+	pqutils.SetLogger(logger)
+	defer pqutils.SetLogger(nil)
+
+	// Nothing listens at this address, so the statement fails and is logged at warn level
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	_, err = pqutils.CountAll(db, "test_table")
+	if err == nil {
+		log.Println("expected: an error without a database")
+		t.FailNow()
+	}
+
+	if len(logger.records) != 1 || logger.records[0].level != "warn" {
+		log.Println("expected: one warn record. Received:", logger.records)
+		t.FailNow()
+	}
+	fields := map[string]any{}
+	args := logger.records[0].args
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[args[i].(string)] = args[i+1]
+	}
+	if stmt, _ := fields["sql"].(string); !strings.Contains(stmt, "FROM test_table") ||
+		fields["duration"] == nil || fields["error"] == nil {
+		log.Println("expected: sql, duration and error fields. Received:", fields)
+		t.FailNow()
+	}
+}
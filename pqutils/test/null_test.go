@@ -0,0 +1,72 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"testing"
+	"time"
+)
+
+type testNullType struct {
+	Id         int            `json:"id" sql:"id,primarykey,serial"`
+	Nickname   *string        `json:"nickname" sql:"nickname"`
+	Age        *int64         `json:"age" sql:"age"`
+	VerifiedAt *time.Time     `json:"verifiedAt" sql:"verified_at"`
+	Email      sql.NullString `json:"email" sql:"email"`
+}
+
+func TestNullRoundTrip(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_null_table", &testNullType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_null_table")
+	}()
+
+	inserted, err := pqutils.Insert(db, "test_null_table", testNullType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if inserted.Nickname != nil || inserted.Age != nil || inserted.VerifiedAt != nil || inserted.Email.Valid {
+		log.Println("expected: NULL columns to scan back as nil. Received:", inserted)
+		t.FailNow()
+	}
+
+	nickname := "Jo"
+	age := int64(42)
+	inserted.Nickname = &nickname
+	inserted.Age = &age
+	inserted.Email = sql.NullString{String: "jo@example.com", Valid: true}
+	_, err = pqutils.UpdateOne(db, "test_null_table", &inserted)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	got, err := pqutils.Get(db, "test_null_table", testNullType{Id: inserted.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if got.Nickname == nil || *got.Nickname != nickname || got.Age == nil || *got.Age != age ||
+		got.VerifiedAt != nil || got.Email != inserted.Email {
+		log.Println("expected:", inserted, "Received:", got)
+		t.FailNow()
+	}
+}
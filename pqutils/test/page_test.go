@@ -0,0 +1,120 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type testPageType struct {
+	Id    int    `json:"id" sql:"id,primarykey,serial"`
+	Group string `json:"group" sql:"group_name"`
+}
+
+func TestSelectPage(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_page_table", &testPageType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_page_table")
+	}()
+
+	var values []testPageType
+	for i := 0; i < 10; i++ {
+		values = append(values, testPageType{Group: "group" + strconv.Itoa(i%3)})
+	}
+	err = pqutils.BulkInsert(db, "test_page_table", values)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	// Walk forwards, then backwards from the last page.  Group is not unique, so the Id tie
+	// breaker decides the order within a group.
+	options := pqutils.QueryOptions{OrderBy: []string{"json:group:desc"}, Limit: 3}
+	var forward []int
+	var pages []pqutils.Page
+	for {
+		page, err := pqutils.SelectPage(db, "test_page_table", &testPageType{}, nil, options)
+		if err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		pages = append(pages, page)
+		for _, result := range page.Results {
+			forward = append(forward, result.(testPageType).Id)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+	if len(forward) != 10 || len(pages) != 4 {
+		log.Println("expected: 10 records on 4 pages. Received:", forward)
+		t.FailNow()
+	}
+
+	all, err := pqutils.SelectAllWithOptions(db, "test_page_table", &testPageType{}, nil,
+		pqutils.QueryOptions{OrderBy: []string{"Group:desc", "Id"}})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	var expected []int
+	for _, result := range all {
+		expected = append(expected, result.(testPageType).Id)
+	}
+	if !reflect.DeepEqual(forward, expected) {
+		log.Println("expected:", expected, "Received:", forward)
+		t.FailNow()
+	}
+
+	options.Cursor = pages[len(pages)-1].PrevCursor
+	page, err := pqutils.SelectPage(db, "test_page_table", &testPageType{}, nil, options)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(page.Results, pages[len(pages)-2].Results) {
+		log.Println("expected:", pages[len(pages)-2].Results, "Received:", page.Results)
+		t.FailNow()
+	}
+}
+
+func TestSelectPageInvalid(t *testing.T) {
+	// Options and cursors are validated before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	for _, options := range []pqutils.QueryOptions{
+		{Limit: 0},
+		{Limit: 10, Offset: 10},
+		{Limit: 10, Cursor: "not a cursor"},
+	} {
+		_, err = pqutils.SelectPage(db, "test_page_table", &testPageType{}, nil, options)
+		if err == nil {
+			log.Println("expected: an error for options", options)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"testing"
+	"time"
+)
+
+type testScanType struct {
+	Id        int64     `json:"id" sql:"id,primarykey,serial"`
+	Active    bool      `json:"active" sql:"active"`
+	Score     float64   `json:"score" sql:"score"`
+	Rank      int32     `json:"rank" sql:"rank"`
+	Notes     string    `json:"notes" sql:"notes"`
+	CreatedAt time.Time `json:"createdAt" sql:"created_at"`
+}
+
+func TestScanColumnTypes(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_scan_table", &testScanType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_scan_table")
+	}()
+
+	want := testScanType{
+		Active:    true,
+		Score:     12.5,
+		Rank:      7,
+		Notes:     "O'Brien",
+		CreatedAt: time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC),
+	}
+	inserted, err := pqutils.Insert(db, "test_scan_table", want)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	got, err := pqutils.Get(db, "test_scan_table", testScanType{Id: inserted.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if got.Active != want.Active || got.Score != want.Score || got.Rank != want.Rank ||
+		got.Notes != want.Notes || !got.CreatedAt.Equal(want.CreatedAt) {
+		log.Println("expected:", want, "Received:", got)
+		t.FailNow()
+	}
+
+	log.Println(got)
+}
+
+type testTextScanType struct {
+	Amount float64 `json:"amount" sql:"amount"`
+	Count  int64   `json:"count" sql:"count"`
+	Uuid   string  `json:"uuid" sql:"uuid"`
+	Notes  string  `json:"notes" sql:"notes"`
+}
+
+func TestScanTextDecodedTypes(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	// NUMERIC, UUID and TEXT come back from the driver as text and are converted by field type
+	_, err = db.Exec(`CREATE TABLE test_text_scan_table (amount NUMERIC, count NUMERIC, uuid UUID, notes TEXT)`)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_text_scan_table")
+	}()
+	_, err = db.Exec(`INSERT INTO test_text_scan_table 
+		VALUES (12.75, 42, 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11', 'text')`)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	results, err := pqutils.Select[testTextScanType](db, "test_text_scan_table", nil, pqutils.QueryOptions{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	want := testTextScanType{Amount: 12.75, Count: 42, Uuid: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", Notes: "text"}
+	if len(results) != 1 || results[0] != want {
+		log.Println("expected:", want, "Received:", results)
+		t.FailNow()
+	}
+}
@@ -1,10 +1,13 @@
 package test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/tnyidea/sqlutils/pqutils"
 	"log"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -101,14 +104,14 @@ func TestSelectOneNoResult(t *testing.T) {
 	}
 
 	result, err := pqutils.SelectOne(db, "test_table", &testType{Id: 99})
-	if err != nil {
-		log.Println(err)
+	if !errors.Is(err, pqutils.ErrNotFound) {
+		log.Println("expected: ErrNotFound. Received:", err)
+		t.FailNow()
+	}
+	if result != (testType{}) {
+		log.Println("expected: the zero value as result. Received:", result)
 		t.FailNow()
 	}
-
-	log.Println(result)
-	w := result.(testType)
-	log.Println(&w)
 }
 
 func TestSelectOneMultipleResults(t *testing.T) {
@@ -147,7 +150,7 @@ func TestSelectAllWithOptions(t *testing.T) {
 		t.FailNow()
 	}
 
-	results, err := pqutils.SelectAllWithOptions(db, "test_table", &testType{}, map[string]interface{}{"FirstName": "John"}, pqutils.QueryOptions{})
+	results, err := pqutils.SelectAllWithOptions(db, "test_table", &testType{}, pqutils.Where{"FirstName": "John"}, pqutils.QueryOptions{})
 	if err != nil {
 		log.Println(err)
 		t.FailNow()
@@ -170,7 +173,7 @@ func TestSelectAllWithFullOptions(t *testing.T) {
 
 	//lastName ASC 24 -1
 	results, err := pqutils.SelectAllWithOptions(db, "test_table", &testType{},
-		map[string]interface{}{"json:firstName": "Jack"}, pqutils.QueryOptions{
+		pqutils.Where{"json:firstName": "Jack"}, pqutils.QueryOptions{
 			OrderBy: []string{"json:id:asc"},
 			Limit:   24,
 			Offset:  -1,
@@ -181,3 +184,144 @@ func TestSelectAllWithFullOptions(t *testing.T) {
 	}
 	log.Println(results)
 }
+
+func TestSelectAllContextCanceled(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = pqutils.SelectAllContext(ctx, db, "test_table", &testType{})
+	var canceledError *pqutils.CanceledError
+	if !errors.As(err, &canceledError) || !errors.Is(err, context.Canceled) {
+		log.Println("expected: CanceledError for canceled context. Received:", err)
+		t.FailNow()
+	}
+}
+
+func TestSelectAllConcurrent(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	// Schema metadata is parsed once and shared, so concurrent selects must agree
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pqutils.SelectAll(db, "test_table", &testType{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSelectAllWithMultiColumnOrder(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	results, err := pqutils.Select[testType](db, "test_table", nil, pqutils.QueryOptions{
+		OrderBy: []string{"json:lastName:ASC", "FirstName:desc:nulls last", "Id"},
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	for i := 1; i < len(results); i++ {
+		previous, current := results[i-1], results[i]
+		if previous.LastName > current.LastName ||
+			(previous.LastName == current.LastName && previous.FirstName < current.FirstName) {
+			log.Println("expected: records ordered by lastName then FirstName descending. Received:", previous, current)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSelectAllWithInvalidOrder(t *testing.T) {
+	// OrderBy is validated before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	for _, orderBy := range []string{"Age", "json:age", "FirstName:up", "FirstName:nulls last:desc"} {
+		_, err = pqutils.SelectAllWithOptions(db, "test_table", &testType{}, nil,
+			pqutils.QueryOptions{OrderBy: []string{orderBy}})
+		if err == nil {
+			log.Println("expected: an error for OrderBy", orderBy)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSelectAllWithColumns(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	results, err := pqutils.Select[testType](db, "test_table", nil, pqutils.QueryOptions{
+		Columns: []string{"Id", "json:lastName"},
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	for _, result := range results {
+		if result.Id == 0 || result.FirstName != "" || result.MiddleName != "" {
+			log.Println("expected: only Id and LastName to be selected. Received:", result)
+			t.FailNow()
+		}
+	}
+
+	_, err = pqutils.Select[testType](db, "test_table", nil, pqutils.QueryOptions{Columns: []string{"Age"}})
+	if err == nil {
+		log.Println("expected: an error for an unknown column field")
+		t.FailNow()
+	}
+}
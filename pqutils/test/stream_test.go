@@ -0,0 +1,131 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type testStreamType struct {
+	Id   int    `json:"id" sql:"id,primarykey,serial"`
+	Name string `json:"name" sql:"name"`
+}
+
+// testStreamSource returns an iterator over count rows that fails once, when it reaches
+// failAt, if failAt is positive
+func testStreamSource(count int, failAt int) func() (testStreamType, bool, error) {
+	i := 0
+	return func() (testStreamType, bool, error) {
+		if i == failAt && failAt > 0 {
+			failAt = 0
+			return testStreamType{}, false, errors.New("source failed")
+		}
+		if i == count {
+			return testStreamType{}, false, nil
+		}
+		i++
+		return testStreamType{Name: "row" + strconv.Itoa(i)}, true, nil
+	}
+}
+
+func TestBulkInsertStreamResume(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_stream_table", &testStreamType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_stream_table")
+	}()
+
+	var progress []int
+	options := pqutils.BulkInsertOptions{ChunkSize: 10, Progress: func(committed int) {
+		progress = append(progress, committed)
+	}}
+
+	// The chunk in progress when the source fails is not committed
+	committed, err := pqutils.BulkInsertStream(db, "test_stream_table", testStreamSource(25, 15), options)
+	var bulkInsertError *pqutils.BulkInsertError
+	if !errors.As(err, &bulkInsertError) || bulkInsertError.Committed != 10 || committed != 10 {
+		log.Println("expected: a BulkInsertError after 10 committed rows. Received:", committed, err)
+		t.FailNow()
+	}
+
+	options.Skip = bulkInsertError.Committed
+	committed, err = pqutils.BulkInsertStream(db, "test_stream_table", testStreamSource(25, 0), options)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if committed != 25 || !reflect.DeepEqual(progress, []int{10, 20, 25}) {
+		log.Println("expected: 25 rows committed in chunks of 10. Received:", committed, progress)
+		t.FailNow()
+	}
+
+	count, err := pqutils.CountAll(db, "test_stream_table")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if count != 25 {
+		log.Println("expected: 25 rows. Received:", count)
+		t.FailNow()
+	}
+}
+
+func TestBulkInsertChannel(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_stream_table", &testStreamType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_stream_table")
+	}()
+
+	rows := make(chan *testStreamType)
+	go func() {
+		defer close(rows)
+		for i := 0; i < 12; i++ {
+			rows <- &testStreamType{Name: "row" + strconv.Itoa(i)}
+		}
+	}()
+
+	committed, err := pqutils.BulkInsertChannel(db, "test_stream_table", rows, pqutils.BulkInsertOptions{ChunkSize: 5})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if committed != 12 {
+		log.Println("expected: 12 rows committed. Received:", committed)
+		t.FailNow()
+	}
+}
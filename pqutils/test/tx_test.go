@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"testing"
+)
+
+func TestWithTxNestedRollback(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	before, err := pqutils.CountAllContext(ctx, db, "test_table")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	errInner := errors.New("inner failure")
+	err = pqutils.WithTx(ctx, db, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
+		_, err := pqutils.InsertOneContext(ctx, tx, "test_table", &testType{FirstName: "Outer", LastName: "Tx"})
+		if err != nil {
+			return err
+		}
+
+		// The nested call rolls back to its savepoint, leaving the outer insert in place
+		err = pqutils.WithTx(ctx, tx, nil, func(tx *sql.Tx) error {
+			_, err := pqutils.InsertOneContext(ctx, tx, "test_table", &testType{FirstName: "Inner", LastName: "Tx"})
+			if err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			return errors.New("expected: inner error from nested WithTx")
+		}
+
+		count, err := pqutils.CountAllContext(ctx, tx, "test_table")
+		if err != nil {
+			return err
+		}
+		if count != before+1 {
+			return errors.New("expected: only the outer insert to remain after the savepoint rollback")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+}
+
+func TestWithTxPanicRollback(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	before, err := pqutils.CountAllContext(ctx, db, "test_table")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				log.Println("expected: WithTx to re-raise the panic")
+				t.FailNow()
+			}
+		}()
+		_ = pqutils.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+			_, err := pqutils.InsertOneContext(ctx, tx, "test_table", &testType{FirstName: "Panic", LastName: "Tx"})
+			if err != nil {
+				return err
+			}
+			panic("rollback")
+		})
+	}()
+
+	after, err := pqutils.CountAllContext(ctx, db, "test_table")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if after != before {
+		log.Println("expected: insert to be rolled back after panic. Before:", before, "After:", after)
+		t.FailNow()
+	}
+}
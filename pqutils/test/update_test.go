@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"github.com/tnyidea/sqlutils/pqutils"
 	"log"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestUpdateOne(t *testing.T) {
@@ -33,3 +35,176 @@ func TestUpdateOne(t *testing.T) {
 
 	log.Println(sqlResult)
 }
+
+func TestUpdateOneWithMask(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	inserted, err := pqutils.Insert(db, "test_table", testType{FirstName: "Mask", MiddleName: "M", LastName: "Test"})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_, _ = pqutils.DeleteOne(db, "test_table", &inserted)
+	}()
+
+	// Only the masked fields are written, the rest of the record keeps its stored values
+	_, err = pqutils.UpdateOne(db, "test_table", &testType{Id: inserted.Id, FirstName: "Masked"},
+		"FirstName", "json:middleName")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	updated, err := pqutils.Get(db, "test_table", testType{Id: inserted.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if updated.FirstName != "Masked" || updated.MiddleName != "" || updated.LastName != "Test" {
+		log.Println("expected: only FirstName and MiddleName to be updated. Received:", updated)
+		t.FailNow()
+	}
+}
+
+func TestUpdateInvalidMask(t *testing.T) {
+	// The mask is validated before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	for _, mask := range [][]string{{"Age"}, {"Id"}, {"json:id"}} {
+		_, err = pqutils.UpdateOne(db, "test_table", &testType{Id: 1}, mask...)
+		if err == nil {
+			log.Println("expected: an error for mask", mask)
+			t.FailNow()
+		}
+	}
+
+	_, err = pqutils.UnsafeUpdateAll(db, "test_table", &testType{}, []string{"Id"})
+	if err == nil {
+		log.Println("expected: an error for masking the serial primary key")
+		t.FailNow()
+	}
+}
+
+func TestUpdateChanged(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	original, err := pqutils.Insert(db, "test_table", testType{FirstName: "Changed", MiddleName: "C", LastName: "Test"})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_, _ = pqutils.DeleteOne(db, "test_table", &original)
+	}()
+
+	// A concurrent edit of another field must survive the update
+	_, err = pqutils.UpdateOne(db, "test_table", &testType{Id: original.Id, LastName: "Concurrent"}, "LastName")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	modified := original
+	modified.FirstName = "Changed Again"
+	result, changed, err := pqutils.UpdateChanged(db, "test_table", &original, &modified)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if result == nil || !reflect.DeepEqual(changed, []string{"first_name"}) {
+		log.Println("expected: only first_name to change. Received:", changed)
+		t.FailNow()
+	}
+
+	updated, err := pqutils.Get(db, "test_table", testType{Id: original.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if updated.FirstName != "Changed Again" || updated.LastName != "Concurrent" {
+		log.Println("expected: FirstName updated and LastName untouched. Received:", updated)
+		t.FailNow()
+	}
+
+	result, changed, err = pqutils.UpdateChanged(db, "test_table", &modified, &modified)
+	if err != nil || result != nil || changed != nil {
+		log.Println("expected: no update when nothing changed. Received:", result, changed, err)
+		t.FailNow()
+	}
+}
+
+func TestUpdateChangedReloadedTime(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_changed_table", &testNullType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_changed_table")
+	}()
+
+	// The time keeps its location in memory, but is reloaded in the session location.
+	// Postgres stores microseconds, so round to those.
+	verifiedAt := time.Now().In(time.FixedZone("Test", 5*60*60)).Round(time.Microsecond)
+	original, err := pqutils.Insert(db, "test_changed_table", testNullType{VerifiedAt: &verifiedAt})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	original.VerifiedAt = &verifiedAt
+
+	reloaded, err := pqutils.Get(db, "test_changed_table", testNullType{Id: original.Id})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	nickname := "Reloaded"
+	reloaded.Nickname = &nickname
+
+	_, changed, err := pqutils.UpdateChanged(db, "test_changed_table", &original, &reloaded)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(changed, []string{"nickname"}) {
+		log.Println("expected: only nickname to change. Received:", changed)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"database/sql"
+	"github.com/tnyidea/sqlutils/pqutils"
+	"log"
+	"testing"
+)
+
+type testUpsertType struct {
+	Id     int    `json:"id" sql:"id,primarykey,serial"`
+	Email  string `json:"email" sql:"email,unique"`
+	Name   string `json:"name" sql:"name"`
+	Visits int    `json:"visits" sql:"visits"`
+}
+
+func TestUpsert(t *testing.T) {
+	config, err := configureTest()
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	db, err := sql.Open("postgres", config.DbUrl)
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	err = pqutils.CreateTableFromType(db, "test_upsert_table", &testUpsertType{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = pqutils.DropTable(db, "test_upsert_table")
+	}()
+
+	// The serial primary key never conflicts, so the unique Email is the conflict target
+	inserted, err := pqutils.Upsert(db, "test_upsert_table", testUpsertType{Email: "a@example.com", Name: "A", Visits: 1},
+		pqutils.UpsertOptions{})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	updated, err := pqutils.Upsert(db, "test_upsert_table", testUpsertType{Email: "a@example.com", Name: "B", Visits: 2},
+		pqutils.UpsertOptions{Mask: []string{"json:visits"}})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if updated.Id != inserted.Id || updated.Name != "A" || updated.Visits != 2 {
+		log.Println("expected: the existing row with only Visits updated. Received:", updated)
+		t.FailNow()
+	}
+
+	ignored, err := pqutils.UpsertOne(db, "test_upsert_table", &testUpsertType{Email: "a@example.com", Name: "C"},
+		pqutils.UpsertOptions{DoNothing: true})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if ignored != nil {
+		log.Println("expected: no row returned for DO NOTHING. Received:", ignored)
+		t.FailNow()
+	}
+
+	results, err := pqutils.UpsertAll(db, "test_upsert_table", []interface{}{
+		&testUpsertType{Email: "a@example.com", Name: "D", Visits: 3},
+		&testUpsertType{Email: "b@example.com", Name: "E", Visits: 1},
+	}, pqutils.UpsertOptions{ConflictFields: []string{"Email"}})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if len(results) != 2 || results[0].(testUpsertType).Id != inserted.Id || results[0].(testUpsertType).Name != "D" {
+		log.Println("expected: the first row updated and the second inserted. Received:", results)
+		t.FailNow()
+	}
+
+	count, err := pqutils.CountAll(db, "test_upsert_table")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	if count != 2 {
+		log.Println("expected: 2 rows. Received:", count)
+		t.FailNow()
+	}
+}
+
+func TestUpsertInvalidOptions(t *testing.T) {
+	// Options are validated before any statement runs, so no database is needed
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+
+	for _, options := range []pqutils.UpsertOptions{
+		{ConflictFields: []string{"Age"}},
+		{Mask: []string{"Id"}},
+	} {
+		_, err = pqutils.UpsertOne(db, "test_upsert_table", &testUpsertType{Email: "a@example.com"}, options)
+		if err == nil {
+			log.Println("expected: an error for options", options)
+			t.FailNow()
+		}
+	}
+
+	// testType has a serial primary key and no unique field, so there is no conflict target
+	_, err = pqutils.UpsertOne(db, "test_table", &testType{}, pqutils.UpsertOptions{})
+	if err == nil {
+		log.Println("expected: an error for a type without a conflict target")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,92 @@
+package pqutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+var savepointCount uint64
+
+// WithTx runs fn inside a transaction on db.  The transaction is committed if fn returns nil,
+// and rolled back if fn returns an error or panics; the panic is re-raised after the rollback.
+//
+// opts sets the isolation level and read-only flag of the transaction and may be nil for the
+// driver defaults.  If db is itself a *sql.Tx, for example when WithTx is called from inside
+// another WithTx, no new transaction is started.  fn runs between a SAVEPOINT and a RELEASE
+// SAVEPOINT instead, and a failure only rolls back to the savepoint, leaving the outer
+// transaction usable.  opts is ignored for nested calls since a savepoint cannot change them.
+//
+// When db is a Client the BEGIN, COMMIT, ROLLBACK and savepoint statements are reported to its
+// hooks as OperationTx.  fn receives the bare *sql.Tx though, so the hooks don't see the
+// statements of fn.  Use Client.WithTx for those.
+func WithTx(ctx context.Context, db Executor, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	conn := db
+	if c, ok := db.(*Client); ok {
+		conn = c.Executor
+	}
+	if tx, ok := conn.(*sql.Tx); ok {
+		return withSavepoint(ctx, db, tx, fn)
+	}
+
+	beginner, ok := conn.(txBeginner)
+	if !ok {
+		return errors.New("invalid executor: a transaction requires a *sql.DB, *sql.Conn or *sql.Tx")
+	}
+	var tx *sql.Tx
+	err := txStatement(ctx, db, "BEGIN", func(ctx context.Context) error {
+		var err error
+		tx, err = beginner.BeginTx(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = txStatement(ctx, db, "ROLLBACK", func(context.Context) error { return tx.Rollback() })
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		_ = txStatement(ctx, db, "ROLLBACK", func(context.Context) error { return tx.Rollback() })
+		return err
+	}
+
+	return contextError(ctx, txStatement(ctx, db, "COMMIT", func(context.Context) error { return tx.Commit() }))
+}
+
+// withSavepoint runs fn under a savepoint of tx.  db is tx, or a Client running on tx whose
+// hooks see the savepoint statements.
+func withSavepoint(ctx context.Context, db Executor, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	savepoint := "pqutils_savepoint_" + strconv.FormatUint(atomic.AddUint64(&savepointCount, 1), 10)
+	if _, err := execStatement(ctx, db, OperationTx, "", `SAVEPOINT `+savepoint); err != nil {
+		return contextError(ctx, err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = execStatement(ctx, db, OperationTx, "", `ROLLBACK TO SAVEPOINT `+savepoint)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		_, _ = execStatement(ctx, db, OperationTx, "", `ROLLBACK TO SAVEPOINT `+savepoint)
+		return err
+	}
+
+	_, err := execStatement(ctx, db, OperationTx, "", `RELEASE SAVEPOINT `+savepoint)
+	return contextError(ctx, err)
+}
+
+// txStatement runs fn, which issues the transaction statement stmt through database/sql rather
+// than as SQL text, and logs and reports it to the hooks of db like execStatement.
+func txStatement(ctx context.Context, db Executor, stmt string, fn func(ctx context.Context) error) error {
+	event := &QueryEvent{Operation: OperationTx, SQL: stmt}
+	ctx = startStatement(ctx, db, event)
+	err := fn(ctx)
+	return finishStatement(ctx, db, event, 0, err)
+}
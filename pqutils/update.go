@@ -3,60 +3,75 @@ package pqutils
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
-	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // UpdateOne will construct a where condition from the primarykey tags on v.  It will then
-// perform an update of the record in the specified table that matches the primary key, using
-// the ENTIRE value of v.  If the update fails, an error will be returned.
-func UpdateOne(db *sql.DB, table string, v interface{}) (sql.Result, error) {
+// perform an update of the record in the specified table that matches the primary key.  The
+// optional mask names the fields to update, by struct field name or json name with a "json:"
+// prefix; without a mask every field except the primary key is updated.  Primary key fields
+// are never updated.  If the update fails, an error will be returned.
+func UpdateOne(db Executor, table string, v interface{}, mask ...string) (sql.Result, error) {
+	return UpdateOneContext(context.Background(), db, table, v, mask...)
+}
+
+// UpdateOneContext is UpdateOne with a caller supplied context.
+func UpdateOneContext(ctx context.Context, db Executor, table string, v interface{}, mask ...string) (sql.Result, error) {
 	// Assumption: v is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(v)
 	if err != nil {
 		return nil, err
 	}
-	stm, err := parseStructMetadata(v)
+
+	where, err := primaryKeyWhere(scm, v)
 	if err != nil {
 		return nil, err
 	}
 
-	var where map[string]interface{}
-	for columnName, keyType := range scm.columnKeyTypeMap {
-		if strings.Contains(keyType, "primarykey") {
-			if where == nil {
-				where = make(map[string]interface{})
-			}
-			fieldName := scm.columnNameFieldNameMap[columnName]
-			where[fieldName] = stm.fieldNameValueMap[fieldName]
-		}
-	}
+	result, err := updateAllWithOptions(ctx, db, table, v, mask, false, where)
+	return result, contextError(ctx, err)
+}
 
-	return updateAllWithOptions(db, table, v, nil, where)
+// UpdateAllWithOptions updates the records in the specified table that match where with the
+// masked value v.  mask names the fields to update as it does for UpdateOne, except that it
+// may also name primary key fields that are not serial.
+func UpdateAllWithOptions(db Executor, table string, v interface{}, mask []string, where Filter) (sql.Result, error) {
+	return UpdateAllWithOptionsContext(context.Background(), db, table, v, mask, where)
 }
 
-func UpdateAllWithOptions(db *sql.DB, table string, v interface{}, mask []string, where map[string]interface{}) (sql.Result, error) {
-	if where == nil {
-		return nil, errors.New("invalid where condition: where must be non-nil. Use UnsafeUpdateAll to update all records")
+// UpdateAllWithOptionsContext is UpdateAllWithOptions with a caller supplied context.
+func UpdateAllWithOptionsContext(ctx context.Context, db Executor, table string, v interface{}, mask []string,
+	where Filter) (sql.Result, error) {
+	if emptyFilter(where) {
+		return nil, errors.New("invalid where condition: where must be non-nil and non-empty. Use UnsafeUpdateAll to update all records")
 	}
 
-	return updateAllWithOptions(db, table, v, mask, where)
+	result, err := updateAllWithOptions(ctx, db, table, v, mask, true, where)
+	return result, contextError(ctx, err)
 }
 
 // UnsafeUpdateAll updates ALL RECORDS in the specified table with the masked value v. This is
 // marked with the prefix Unsafe to remind the user that it is a destructive function and should
 // be used carefully.
-func UnsafeUpdateAll(db *sql.DB, table string, v interface{}, mask []string) (sql.Result, error) {
-	return updateAllWithOptions(db, table, v, mask, nil)
+func UnsafeUpdateAll(db Executor, table string, v interface{}, mask []string) (sql.Result, error) {
+	return UnsafeUpdateAllContext(context.Background(), db, table, v, mask)
 }
 
-func updateAllWithOptions(db *sql.DB, table string, v interface{}, mask []string, where map[string]interface{}) (sql.Result, error) {
-	// Assumption: v is a pointer to a struct
+// UnsafeUpdateAllContext is UnsafeUpdateAll with a caller supplied context.
+func UnsafeUpdateAllContext(ctx context.Context, db Executor, table string, v interface{}, mask []string) (sql.Result, error) {
+	result, err := updateAllWithOptions(ctx, db, table, v, mask, true, nil)
+	return result, contextError(ctx, err)
+}
 
-	// TODO need to come up with a mask or something to decide which values actually get updated
-	//   OR does schemaType need to be a struct of pointers?
+func updateAllWithOptions(ctx context.Context, db Executor, table string, v interface{}, mask []string,
+	maskKeys bool, where Filter) (sql.Result, error) {
+	// Assumption: v is a pointer to a struct
 
 	scm, err := parseSchemaMetadata(v)
 	if err != nil {
@@ -67,34 +82,159 @@ func updateAllWithOptions(db *sql.DB, table string, v interface{}, mask []string
 		return nil, err
 	}
 
-	// TODO... consider making this a standard parameterized exec
-	stmtColumns := scm.columnNames
+	stmtColumns, err := updateColumns(scm, stm, mask, maskKeys)
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO Implement mask
-	var stmtValues []string
+	var stmtAssignments []string
+	var stmtValues []interface{}
+	rv := reflect.ValueOf(v).Elem()
 	for _, columnName := range stmtColumns {
-		fieldName := scm.columnNameFieldNameMap[columnName]
-		stmtValues = append(stmtValues, "'"+fmt.Sprintf("%v", stm.fieldNameValueMap[fieldName])+"'")
+		stmtValues = append(stmtValues, scm.columnArg(columnName, scm.columnValue(rv, columnName)))
+		stmtAssignments = append(stmtAssignments, columnName+" = $"+strconv.Itoa(len(stmtValues)))
 	}
 
-	condition, err := queryConditionString(v, where, QueryOptions{})
+	condition, args, err := queryConditionString(v, where, QueryOptions{}, stmtValues)
 	if err != nil {
 		return nil, err
 	}
 	stmt := `UPDATE ` + table + ` ` +
-		`SET (` + strings.Join(stmtColumns, ", ") + `) = ` +
-		`(` + strings.Join(stmtValues, ", ") + `) ` +
+		`SET ` + strings.Join(stmtAssignments, ", ") + ` ` +
 		condition
 
 	// Execute the Statement
-	ctx := context.Background()
-	conn, err := db.Conn(ctx)
+	return execStatement(ctx, db, OperationUpdate, table, stmt, args...)
+}
+
+// updateColumns returns the columns an update SETs, in schema order.  An empty mask selects
+// every column except the primary key.  Otherwise mask names the fields to update, and it may
+// name primary key fields only when maskKeys is true.  Serial primary keys are never updated.
+func updateColumns(scm schemaMetadata, stm structMetadata, mask []string, maskKeys bool) ([]string, error) {
+	masked := make(map[string]bool, len(mask))
+	b := &conditionBuilder{scm: scm, stm: stm}
+	for _, name := range mask {
+		columnName, err := b.columnName(name)
+		if err != nil {
+			return nil, errors.New("invalid fieldName for update mask: " + name)
+		}
+		keyType := scm.columnKeyTypeMap[columnName]
+		if keyType == "primarykey:serial" || (!maskKeys && strings.HasPrefix(keyType, "primarykey")) {
+			return nil, errors.New("invalid fieldName for update mask: primary key fields can't be updated: " + name)
+		}
+		masked[columnName] = true
+	}
+
+	var columnNames []string
+	for _, columnName := range scm.columnNames {
+		if len(mask) == 0 && strings.HasPrefix(scm.columnKeyTypeMap[columnName], "primarykey") {
+			continue
+		}
+		if len(mask) == 0 || masked[columnName] {
+			columnNames = append(columnNames, columnName)
+		}
+	}
+	if columnNames == nil {
+		return nil, errors.New("invalid update: " + scm.schemaType.String() + " has no fields to update")
+	}
+
+	return columnNames, nil
+}
+
+// UpdateChanged compares original, the record as it was loaded, with modified, the same record
+// after the caller's changes, and updates only the fields that differ.  The record is found by
+// the primary key of original, which modified must share.  It returns the names of the changed
+// columns, and when nothing changed no statement is executed and the sql.Result is nil.
+func UpdateChanged(db Executor, table string, original interface{}, modified interface{}) (sql.Result, []string, error) {
+	return UpdateChangedContext(context.Background(), db, table, original, modified)
+}
+
+// UpdateChangedContext is UpdateChanged with a caller supplied context.
+func UpdateChangedContext(ctx context.Context, db Executor, table string, original interface{},
+	modified interface{}) (sql.Result, []string, error) {
+	// Assumption: original and modified are pointers to the same struct type
+
+	scm, err := parseSchemaMetadata(original)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if reflect.TypeOf(modified) != reflect.TypeOf(original) || reflect.ValueOf(modified).IsNil() {
+		return nil, nil, &InvalidTypeError{RequiredType: "non-nil " + reflect.TypeOf(original).String(),
+			InvalidType: reflect.TypeOf(modified)}
+	}
+
+	where, err := primaryKeyWhere(scm, original)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ov := reflect.ValueOf(original).Elem()
+	mv := reflect.ValueOf(modified).Elem()
+	var mask []string
+	var changedColumns []string
+	for _, columnName := range scm.columnNames {
+		if columnValuesEqual(scm, columnName, scm.columnValue(ov, columnName), scm.columnValue(mv, columnName)) {
+			continue
+		}
+		if strings.HasPrefix(scm.columnKeyTypeMap[columnName], "primarykey") {
+			return nil, nil, errors.New("invalid update: primary key field changed: " +
+				scm.columnNameFieldNameMap[columnName])
+		}
+		mask = append(mask, scm.columnNameFieldNameMap[columnName])
+		changedColumns = append(changedColumns, columnName)
+	}
+	if mask == nil {
+		return nil, nil, nil
+	}
+
+	result, err := updateAllWithOptions(ctx, db, table, modified, mask, false, where)
+	if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+	return result, changedColumns, nil
+}
+
+// columnValuesEqual reports whether two values of the column would be written the same way.
+// They are compared as the driver values they are written as, so pointers and Null types are
+// compared by what they hold.  Times are compared as instants, so a value reloaded in another
+// location is not a change.
+func columnValuesEqual(scm schemaMetadata, columnName string, a interface{}, b interface{}) bool {
+	av, err := comparableValue(scm.columnArg(columnName, a))
+	if err != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	bv, err := comparableValue(scm.columnArg(columnName, b))
+	if err != nil {
+		return reflect.DeepEqual(a, b)
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
 
-	return conn.ExecContext(ctx, stmt)
+	switch at := av.(type) {
+	case time.Time:
+		bt, ok := bv.(time.Time)
+		return ok && at.Equal(bt)
+	case timeArray:
+		bt, ok := bv.(timeArray)
+		if !ok || len(at) != len(bt) || (at == nil) != (bt == nil) {
+			return false
+		}
+		for i := range at {
+			if !at[i].Equal(bt[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// comparableValue returns the driver value of the statement argument arg.  A timeArray is
+// returned unchanged, since its text form holds the location of every time.
+func comparableValue(arg interface{}) (interface{}, error) {
+	switch value := arg.(type) {
+	case timeArray:
+		return value, nil
+	case driver.Valuer:
+		return value.Value()
+	}
+	return arg, nil
 }
@@ -0,0 +1,143 @@
+package pqutils
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// UpsertOptions controls how UpsertOne and UpsertAll resolve a conflict with an existing row.
+type UpsertOptions struct {
+	// ConflictFields names the fields of the primary key or unique constraint that detects a
+	// conflict, by struct field name or json name with a "json:" prefix.  When it is empty the
+	// primary key is used, or the unique field when the primary key is serial.
+	ConflictFields []string
+
+	// Mask names the fields that are updated when a conflict is found, as it does for
+	// UpdateOne.  When it is empty every inserted field except the key is updated.
+	Mask []string
+
+	// DoNothing leaves a conflicting row unchanged instead of updating it.
+	DoNothing bool
+}
+
+// UpsertOne inserts v, or updates the existing row when the insert conflicts with it, in a
+// single INSERT ... ON CONFLICT statement.  It returns the row as stored by the database.  With
+// options.DoNothing a conflicting row is left alone and the result is nil.
+func UpsertOne(db Executor, table string, v interface{}, options UpsertOptions) (interface{}, error) {
+	return UpsertOneContext(context.Background(), db, table, v, options)
+}
+
+// UpsertOneContext is UpsertOne with a caller supplied context.
+func UpsertOneContext(ctx context.Context, db Executor, table string, v interface{}, options UpsertOptions) (interface{}, error) {
+	result, err := upsertOne(ctx, db, table, v, options)
+	return result, contextError(ctx, err)
+}
+
+// UpsertAll upserts every element of v as UpsertOne does, inside one transaction so either all
+// of them are stored or none are.  The results are in the order of v.
+func UpsertAll(db Executor, table string, v []interface{}, options UpsertOptions) ([]interface{}, error) {
+	return UpsertAllContext(context.Background(), db, table, v, options)
+}
+
+// UpsertAllContext is UpsertAll with a caller supplied context.
+func UpsertAllContext(ctx context.Context, db Executor, table string, v []interface{},
+	options UpsertOptions) ([]interface{}, error) {
+	var results []interface{}
+	err := withTx(ctx, db, nil, func(tx Executor) error {
+		results = nil
+		for _, value := range v {
+			result, err := upsertOne(ctx, tx, table, value, options)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return results, nil
+}
+
+func upsertOne(ctx context.Context, db Executor, table string, v interface{}, options UpsertOptions) (interface{}, error) {
+	// Assumption: v is a pointer to a struct
+
+	clause, err := onConflictClause(v, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return insertReturning(ctx, db, table, v, clause)
+}
+
+// onConflictClause returns the ON CONFLICT clause of an upsert of v.  Updated columns are set
+// from EXCLUDED, the row that failed to insert, so no extra arguments are needed.
+func onConflictClause(v interface{}, options UpsertOptions) (string, error) {
+	scm, err := parseSchemaMetadata(v)
+	if err != nil {
+		return "", err
+	}
+	stm, err := parseStructMetadata(v)
+	if err != nil {
+		return "", err
+	}
+
+	conflictColumns, err := upsertConflictColumns(scm, stm, options.ConflictFields)
+	if err != nil {
+		return "", err
+	}
+	clause := "ON CONFLICT (" + strings.Join(conflictColumns, ", ") + ") "
+	if options.DoNothing {
+		return clause + "DO NOTHING ", nil
+	}
+
+	updateColumnNames, err := updateColumns(scm, stm, options.Mask, false)
+	if err != nil {
+		return "", err
+	}
+	var assignments []string
+	for _, columnName := range updateColumnNames {
+		assignments = append(assignments, columnName+" = EXCLUDED."+columnName)
+	}
+
+	return clause + "DO UPDATE SET " + strings.Join(assignments, ", ") + " ", nil
+}
+
+// upsertConflictColumns returns the conflict target of an upsert: the columns of
+// conflictFields, or the columns the tags of the schema imply.
+func upsertConflictColumns(scm schemaMetadata, stm structMetadata, conflictFields []string) ([]string, error) {
+	var columnNames []string
+	if len(conflictFields) > 0 {
+		b := &conditionBuilder{scm: scm, stm: stm}
+		for _, name := range conflictFields {
+			columnName, err := b.columnName(name)
+			if err != nil {
+				return nil, errors.New("invalid fieldName for UpsertOptions.ConflictFields: " + name)
+			}
+			columnNames = append(columnNames, columnName)
+		}
+		return columnNames, nil
+	}
+
+	// A serial primary key is assigned by the database, so it never conflicts
+	if len(scm.primaryKeyColumns) > 0 && scm.columnKeyTypeMap[scm.primaryKeyColumns[0]] != "primarykey:serial" {
+		return scm.primaryKeyColumns, nil
+	}
+	for _, columnName := range scm.columnNames {
+		if scm.columnKeyTypeMap[columnName] == "unique" {
+			columnNames = append(columnNames, columnName)
+		}
+	}
+	switch len(columnNames) {
+	case 0:
+		return nil, errors.New("invalid upsert: " + scm.schemaType.String() +
+			" has no primarykey or unique fields to detect a conflict. Set UpsertOptions.ConflictFields")
+	case 1:
+		return columnNames, nil
+	}
+	return nil, errors.New("invalid upsert: " + scm.schemaType.String() +
+		" has more than one unique field. Set UpsertOptions.ConflictFields to choose the conflict target")
+}
@@ -0,0 +1,63 @@
+package pqutils
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// driverValue returns v in a form that can be passed as a statement argument.  Values the
+// driver already understands (ints, bools, strings, times, ...) are returned unchanged so
+// they keep their type, while slices other than []byte are sent as Postgres arrays.  Pointers
+// are dereferenced, and nil pointers become NULL.
+func driverValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return v
+	}
+	if _, ok := v.([]byte); ok {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		// Nullable fields: a nil pointer is written as NULL
+		if rv.IsNil() {
+			return nil
+		}
+		return driverValue(rv.Elem().Interface())
+	case reflect.Slice:
+		return arrayValue(v)
+	}
+
+	return v
+}
+
+// jsonbValue is the driver value of a JSONB column
+type jsonbValue struct {
+	v interface{}
+}
+
+// Value implements the driver.Valuer interface.  nil pointers, maps, slices and interfaces are
+// written as NULL rather than the JSON null.
+func (j jsonbValue) Value() (driver.Value, error) {
+	rv := reflect.ValueOf(j.v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	}
+
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}